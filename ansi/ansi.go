@@ -0,0 +1,495 @@
+// Package ansi renders typeup documents for terminals, styled with ANSI
+// escape sequences. Links are OSC 8 hyperlinks, which most terminals
+// make clickable and the rest ignore.
+package ansi
+
+import (
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const reset = "\x1b[0m"
+
+// headingStyles are the styles of the heading levels, from 1 to 6.
+var headingStyles = []string{
+	"\x1b[1;4;35m",
+	"\x1b[1;34m",
+	"\x1b[1;36m",
+	"\x1b[1;32m",
+	"\x1b[1;33m",
+	"\x1b[1;37m",
+}
+
+var calloutStyles = map[string]string{
+	"note":      "\x1b[34m",
+	"info":      "\x1b[34m",
+	"tip":       "\x1b[32m",
+	"important": "\x1b[35m",
+	"warning":   "\x1b[33m",
+	"caution":   "\x1b[33m",
+	"danger":    "\x1b[31m",
+}
+
+const (
+	dim       = "\x1b[2m"
+	codeStyle = "\x1b[36m"
+	mathStyle = "\x1b[35m"
+	linkStyle = "\x1b[4;34m"
+)
+
+// Fprint writes nodes to w, fitting the lines into width columns.
+func Fprint(w io.Writer, nodes []ast.Node, width int) error {
+	_, err := io.WriteString(w, Print(nodes, width))
+	return err
+}
+
+// Print returns nodes styled for a terminal, fitting the lines into width
+// columns where possible; code and long words are not broken.
+func Print(nodes []ast.Node, width int) string {
+	lines := blocks(nodes, width)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// span is a word of text and the escape sequences to style it.
+type span struct {
+	text        string
+	open, close string
+	// end marks the last word of a link, so a link right after it is
+	// not joined into the same hyperlink
+	end bool
+}
+
+func (s span) width() int { return utf8.RuneCountInString(s.text) }
+
+// clean removes the control characters from s, so the document can not
+// send its own escape sequences to the terminal.
+func clean(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' && r != '\t' || r >= 0x7f && r < 0xa0 {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func styled(text, style string) []span {
+	var out []span
+	for _, w := range strings.Fields(clean(text)) {
+		if style == "" {
+			out = append(out, span{text: w})
+		} else {
+			out = append(out, span{text: w, open: style, close: reset})
+		}
+	}
+	return out
+}
+
+func spans(n ast.TextNode) []span {
+	switch n := n.(type) {
+	case *ast.Text:
+		switch n.Style {
+		case ast.Bold:
+			return styled(n.Text, "\x1b[1m")
+		case ast.Italic:
+			return styled(n.Text, "\x1b[3m")
+		case ast.BoldAndItalic:
+			return styled(n.Text, "\x1b[1;3m")
+		default:
+			return styled(n.Text, "")
+		}
+	case *ast.TextBlock:
+		var out []span
+		for _, x := range n.Items {
+			out = append(out, spans(x)...)
+		}
+		return out
+	case *ast.Anchor:
+		words := spans(n.Text)
+		if len(words) == 0 {
+			words = []span{{text: clean(n.URL)}}
+		}
+		link := fmt.Sprintf("\x1b]8;;%s\x1b\\", clean(n.URL))
+		for i, w := range words {
+			words[i].open = link + linkStyle + w.open
+			words[i].close = reset + "\x1b]8;;\x1b\\"
+		}
+		words[len(words)-1].end = true
+		return words
+	case *ast.InlineCode:
+		return []span{{text: clean(n.Text), open: codeStyle, close: reset}}
+	case *ast.Code:
+		return []span{{text: clean(strings.TrimSpace(n.Text)), open: codeStyle, close: reset}}
+	case *ast.Math:
+		return []span{{text: clean(n.TeX), open: mathStyle, close: reset}}
+	default:
+		return styled(n.Bare(), "")
+	}
+}
+
+// wrap fills words into lines of at most width columns.
+func wrap(words []span, width int) []string {
+	var (
+		lines []string
+		line  []span
+		n     int
+	)
+	for _, w := range words {
+		if len(line) > 0 && n+1+w.width() > width {
+			lines = append(lines, join(line))
+			line, n = nil, 0
+		}
+		if len(line) > 0 {
+			n++
+		}
+		line = append(line, w)
+		n += w.width()
+	}
+	if len(line) > 0 {
+		lines = append(lines, join(line))
+	}
+	return lines
+}
+
+// join returns words separated by spaces, keeping words of the same
+// style inside a single pair of escape sequences. Each link is closed
+// after its last word.
+func join(words []span) string {
+	var out strings.Builder
+	for i, w := range words {
+		same := i > 0 && !words[i-1].end && words[i-1].open == w.open && words[i-1].close == w.close
+		if i > 0 {
+			if !same {
+				out.WriteString(words[i-1].close)
+			}
+			out.WriteByte(' ')
+		}
+		if !same {
+			out.WriteString(w.open)
+		}
+		out.WriteString(w.text)
+	}
+	if len(words) > 0 {
+		out.WriteString(words[len(words)-1].close)
+	}
+	return out.String()
+}
+
+// visible returns the number of columns s takes on a terminal.
+func visible(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' {
+			i += escapeLen(s[i:])
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n++
+	}
+	return n
+}
+
+// escapeLen returns the length of the escape sequence at the start of s.
+func escapeLen(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+	switch s[1] {
+	case '[':
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+		}
+	case ']':
+		if i := strings.Index(s, "\x1b\\"); i > 0 {
+			return i + 2
+		}
+	}
+	return len(s)
+}
+
+func indent(lines []string, prefix string) []string {
+	out := make([]string, len(lines))
+	for i, ln := range lines {
+		out[i] = prefix + ln
+	}
+	return out
+}
+
+func blocks(nodes []ast.Node, width int) []string {
+	var out []string
+	for _, n := range nodes {
+		lines := block(n, width)
+		if len(lines) == 0 {
+			continue
+		}
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, lines...)
+	}
+	return out
+}
+
+func block(n ast.Node, width int) []string {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		return wrap(spans(n), width)
+	case *ast.Heading:
+		text := strings.Join(strings.Fields(clean(n.Number+" "+n.Title.Bare())), " ")
+		if n.IsTitle {
+			pad := (width - utf8.RuneCountInString(text)) / 2
+			if pad < 0 {
+				pad = 0
+			}
+			return []string{strings.Repeat(" ", pad) + "\x1b[1;4m" + text + reset}
+		}
+		level := n.Level
+		if level < 1 {
+			level = 1
+		} else if level > len(headingStyles) {
+			level = len(headingStyles)
+		}
+		return []string{headingStyles[level-1] + strings.Repeat("#", level) + " " + text + reset}
+	case *ast.UnorderedList:
+		return list(n.Items, width, func(int) string { return "•" })
+	case *ast.OrderedList:
+		return list(n.Items, width, func(i int) string { return fmt.Sprintf("%d.", i+1) })
+	case *ast.Table:
+		return captioned("Table", n.Number, table(n, width))
+	case *ast.Code:
+		var out []string
+		for _, ln := range strings.Split(strings.Trim(clean(n.Text), "\n"), "\n") {
+			out = append(out, "    "+codeStyle+ln+reset)
+		}
+		return captioned("Listing", n.Number, out)
+	case *ast.Image:
+		kind := "image"
+		if n.Number != "" {
+			kind = "Figure " + n.Number
+		}
+		return []string{media(kind, n.Attrs["alt"], n.Attrs["src"])}
+	case *ast.Video:
+		return []string{media("video", "", n.Source)}
+	case *ast.BlockQuote:
+		lines := blocks(n.Blocks, width-2)
+		if n.Attribution != nil || n.Cite != "" {
+			words := []span{{text: "—"}}
+			if n.Attribution != nil {
+				words = append(words, spans(n.Attribution)...)
+			}
+			if n.Cite != "" {
+				words = append(words, spans(&ast.Anchor{Text: &ast.Text{Text: n.Cite}, URL: n.Cite})...)
+			}
+			lines = append(lines, wrap(words, width-2)...)
+		}
+		return indent(lines, dim+"│"+reset+" ")
+	case *ast.Callout:
+		style, ok := calloutStyles[n.Kind]
+		if !ok {
+			style = calloutStyles["note"]
+		}
+		head := []span{{text: strings.ToUpper(n.Kind), open: style + "\x1b[1m", close: reset}}
+		if n.Title != nil {
+			head[0].text += ":"
+			head = append(head, spans(n.Title)...)
+		}
+		lines := wrap(head, width-2)
+		if body := blocks(n.Blocks, width-2); len(body) > 0 {
+			lines = append(append(lines, ""), body...)
+		}
+		return indent(lines, style+"▌"+reset+" ")
+	case *ast.Math:
+		var out []string
+		for _, ln := range strings.Split(clean(n.TeX), "\n") {
+			out = append(out, "    "+mathStyle+ln+reset)
+		}
+		return out
+	case *ast.ThemeBreak:
+		if width < 1 {
+			width = 1
+		}
+		return []string{dim + strings.Repeat("─", width) + reset}
+	default:
+		return nil
+	}
+}
+
+// captioned puts a bold "Table 2" line over the lines of a numbered block.
+func captioned(kind, number string, lines []string) []string {
+	if number == "" {
+		return lines
+	}
+	return append([]string{"\x1b[1m" + kind + " " + number + reset}, lines...)
+}
+
+func media(kind, alt, src string) string {
+	text := "[" + kind + "]"
+	if alt = strings.TrimSpace(clean(alt)); alt != "" {
+		text = "[" + kind + ": " + alt + "]"
+	}
+	return fmt.Sprintf("\x1b]8;;%s\x1b\\%s%s%s\x1b]8;;\x1b\\", clean(src), linkStyle, text, reset)
+}
+
+func list(items []*ast.ListItem, width int, marker func(i int) string) []string {
+	var (
+		out   []string
+		multi bool // the previous item holds several blocks
+	)
+	for i, x := range items {
+		m := marker(i)
+		pad := strings.Repeat(" ", utf8.RuneCountInString(m)+1)
+		lines := indent(blocks(x.Blocks, width-len(pad)), pad)
+		if len(lines) == 0 {
+			lines = []string{""}
+		}
+		lines[0] = dim + m + reset + " " + strings.TrimPrefix(lines[0], pad)
+		if (multi || len(x.Blocks) > 1) && len(out) > 0 {
+			out = append(out, "")
+		}
+		multi = len(x.Blocks) > 1
+		out = append(out, lines...)
+	}
+	return out
+}
+
+// table draws t with box drawing characters, wrapping the cells so the
+// table fits into width columns if it can.
+func table(t *ast.Table, width int) []string {
+	rows := [][][]span{cells(t.Headers, true)}
+	for _, r := range t.Rows {
+		rows = append(rows, cells(r, false))
+	}
+	var widths []int
+	for _, r := range rows {
+		for i, c := range r {
+			if i >= len(widths) {
+				widths = append(widths, 1)
+			}
+			if n := lineWidth(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	if len(widths) == 0 {
+		return nil
+	}
+	// shrink the widest column until the table fits
+	for {
+		total := 1
+		widest := 0
+		for i, w := range widths {
+			total += w + 3
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if total <= width || widths[widest] <= 6 {
+			break
+		}
+		widths[widest]--
+	}
+
+	rule := func(left, mid, right string) string {
+		var b strings.Builder
+		b.WriteString(dim + left)
+		for i, w := range widths {
+			if i > 0 {
+				b.WriteString(mid)
+			}
+			b.WriteString(strings.Repeat("─", w+2))
+		}
+		b.WriteString(right + reset)
+		return b.String()
+	}
+	bar := dim + "│" + reset
+	out := []string{rule("┌", "┬", "┐")}
+	for ri, r := range rows {
+		var (
+			wrapped [][]string
+			height  = 1
+		)
+		for i := range widths {
+			var lines []string
+			if i < len(r) {
+				lines = wrap(breakLong(r[i], widths[i]), widths[i])
+			}
+			if len(lines) > height {
+				height = len(lines)
+			}
+			wrapped = append(wrapped, lines)
+		}
+		for h := 0; h < height; h++ {
+			var b strings.Builder
+			b.WriteString(bar)
+			for i, w := range widths {
+				c := ""
+				if h < len(wrapped[i]) {
+					c = wrapped[i][h]
+				}
+				b.WriteString(" " + c)
+				if n := visible(c); n < w {
+					b.WriteString(strings.Repeat(" ", w-n))
+				}
+				b.WriteString(" " + bar)
+			}
+			out = append(out, b.String())
+		}
+		if ri == 0 {
+			out = append(out, rule("├", "┼", "┤"))
+		}
+	}
+	return append(out, rule("└", "┴", "┘"))
+}
+
+func cells(nodes []ast.TextNode, header bool) [][]span {
+	out := make([][]span, len(nodes))
+	for i, x := range nodes {
+		out[i] = spans(x)
+		if header {
+			for j := range out[i] {
+				out[i][j].open += "\x1b[1m"
+				if out[i][j].close == "" {
+					out[i][j].close = reset
+				}
+			}
+		}
+	}
+	return out
+}
+
+// breakLong splits the words longer than width.
+func breakLong(words []span, width int) []span {
+	var out []span
+	for _, w := range words {
+		r := []rune(w.text)
+		for len(r) > width {
+			out = append(out, span{text: string(r[:width]), open: w.open, close: w.close})
+			r = r[width:]
+		}
+		if len(r) > 0 {
+			w.text = string(r)
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// lineWidth returns the width of words on a single line.
+func lineWidth(words []span) int {
+	n := 0
+	for i, w := range words {
+		if i > 0 {
+			n++
+		}
+		n += w.width()
+	}
+	return n
+}
@@ -0,0 +1,51 @@
+package ansi
+
+import (
+	"github.com/insomnimus/typeup/transpiler"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, src string) string {
+	t.Helper()
+	d := transpiler.Parse(src)
+	if _, err := d.Apply(nil); err != nil {
+		t.Fatal(err)
+	}
+	return Print(d.Nodes, 40)
+}
+
+func TestPrint(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.tup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test data")
+	}
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := os.ReadFile(strings.TrimSuffix(path, ".tup") + ".txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := render(t, string(src)); got != string(expected) {
+			t.Errorf("%s:\ngot:\n%q\nwant:\n%q", path, got, expected)
+		}
+	}
+}
+
+func TestAdjacentLinks(t *testing.T) {
+	got := render(t, "[one https://x.org] [two words https://x.org]")
+	if n := strings.Count(got, "\x1b]8;;https://x.org\x1b\\"); n != 2 {
+		t.Errorf("%q: %d hyperlinks, want 2", got, n)
+	}
+	if n := strings.Count(got, "\x1b]8;;\x1b\\"); n != 2 {
+		t.Errorf("%q: %d hyperlinks closed, want 2", got, n)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"github.com/insomnimus/typeup/astjson"
+	"io"
+	"log"
+	"os"
+)
+
+func runAST(args []string) {
+	fs := flag.NewFlagSet("ast", flag.ExitOnError)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: typeup ast [file]\n\nPrint the syntax tree of a document as JSON.\n"))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	out, err := astjson.Marshal(astjson.FromSource(string(data)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err = os.Stdout.Write(append(out, '\n')); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,12 +1,6 @@
 package ast
 
-import (
-	"fmt"
-	"html"
-	"strings"
-)
-
-var escape = html.EscapeString
+import "strings"
 
 type TextStyle int
 
@@ -17,18 +11,25 @@ const (
 	BoldAndItalic
 )
 
+// Node is a block of a document. Nodes are turned into output by the
+// render package.
+//
+// Node types other than the ones in this package can be produced by
+// parser extensions; BlockNode does nothing but mark them as nodes.
 type Node interface {
-	HTML() string
+	BlockNode()
 }
 
+// TextNode is text, or an element that can be used within text.
+// Like Node, it can be implemented by the types of parser extensions.
 type TextNode interface {
+	// Bare returns the text without markup.
 	Bare() string
-	textHTML() string
-	listHTML() string
+	InlineNode()
 }
 
-type ListItem interface {
-	listHTML() string
+type ListItem struct {
+	Blocks []Node
 }
 
 type Text struct {
@@ -36,40 +37,15 @@ type Text struct {
 	Text  string
 }
 
-func (t *Text) textHTML() string {
-	switch t.Style {
-	case Bold:
-		return fmt.Sprintf("<b> %s </b>", escape(t.Text))
-	case Italic:
-		return fmt.Sprintf("<i> %s </i>", escape(t.Text))
-	case BoldAndItalic:
-		return fmt.Sprintf("<b><i> %s </i></b>", escape(t.Text))
-	default:
-		return escape(t.Text)
-	}
-}
-func (t *Text) listHTML() string { return t.textHTML() }
-func (t *Text) Bare() string     { return t.Text }
+func (t *Text) InlineNode()  {}
+func (t *Text) Bare() string { return t.Text }
 
 type TextBlock struct {
 	Items []TextNode
 }
 
-func (t *TextBlock) HTML() string {
-	var out strings.Builder
-	out.WriteString("<p>\n")
-	var tmp string
-	for _, text := range t.Items {
-		tmp = strings.TrimSpace(text.textHTML())
-		if tmp == "" {
-			continue
-		}
-		out.WriteString(tmp)
-		out.WriteRune('\n')
-	}
-	out.WriteString("</p>")
-	return out.String()
-}
+func (tb *TextBlock) BlockNode()  {}
+func (tb *TextBlock) InlineNode() {}
 
 func (tb *TextBlock) Bare() string {
 	var elems []string
@@ -79,181 +55,149 @@ func (tb *TextBlock) Bare() string {
 	return strings.Join(elems, " ")
 }
 
-func (tb *TextBlock) textHTML() string {
-	var out strings.Builder
-	var tmp string
-	for _, t := range tb.Items {
-		tmp = strings.TrimSpace(t.textHTML())
-		if tmp == "" {
-			continue
-		}
-		out.WriteString(tmp)
-		out.WriteRune('\n')
-	}
-	return out.String()
-}
-
-func (tb *TextBlock) listHTML() string {
-	var out strings.Builder
-	for _, t := range tb.Items {
-		fmt.Fprintf(&out, "%s ", t.listHTML())
-	}
-	return out.String()
-}
-
 type Heading struct {
-	Title TextNode
-	Level int
+	Title      TextNode
+	Level      int
+	ID         string
+	IsTitle    bool   // declared with '=#', the document title
+	Unnumbered bool   // declared with '#*', left out of section numbering
+	Label      string // for cross references, see Ref
+	Number     string // set by transform.NumberSections, may be empty
 }
 
-func (h *Heading) HTML() string {
-	return fmt.Sprintf("<h%d> %s </h%d>", h.Level,
-		strings.ReplaceAll(h.Title.textHTML(), "\n", ""), h.Level)
-}
+func (h *Heading) BlockNode() {}
 
 type OrderedList struct {
-	Items []ListItem
-}
-
-func (ol *OrderedList) HTML() string {
-	var out strings.Builder
-	out.WriteString("<ol>\n")
-	for _, x := range ol.Items {
-		fmt.Fprintf(&out, "<li> %s </li>\n", x.listHTML())
-	}
-	out.WriteString("</ol>")
-	return out.String()
+	Items []*ListItem
 }
 
-func (ol *OrderedList) listHTML() string {
-	return ol.HTML()
-}
+func (ol *OrderedList) BlockNode() {}
 
 type UnorderedList struct {
-	Items []ListItem
+	Items []*ListItem
 }
 
-func (ul *UnorderedList) HTML() string {
-	var out strings.Builder
-	out.WriteString("<ul>\n")
-	for _, x := range ul.Items {
-		fmt.Fprintf(&out, "<li> %s </li>\n", x.listHTML())
-	}
-	out.WriteString("</ul>")
-	return out.String()
-}
-
-func (ul *UnorderedList) listHTML() string { return ul.HTML() }
+func (ul *UnorderedList) BlockNode() {}
 
 type Anchor struct {
-	Text TextNode
-	URL  string
+	Text  TextNode
+	URL   string
+	Title string // may be empty
+	// Ref is the label of a reference link, written "[text][label]".
+	// Its URL and title are filled in from the LinkDef with the label by
+	// transform.ResolveLinks.
+	Ref string
 }
 
+func (a *Anchor) InlineNode()  {}
 func (a *Anchor) Bare() string { return a.Text.Bare() }
-func (a *Anchor) textHTML() string {
-	return fmt.Sprintf("<a href=%q> %s </a>",
-		a.URL,
-		a.Text.textHTML())
+
+// LinkDef defines the target of the reference links with its label,
+// written `[label]: url "title"` on a line of its own.
+type LinkDef struct {
+	Label string
+	URL   string
+	Title string // may be empty
 }
 
-func (a *Anchor) listHTML() string { return a.textHTML() }
+func (*LinkDef) BlockNode() {}
+
+// NormalizeLabel returns s lower cased with runs of spaces collapsed,
+// the form in which link labels are matched.
+func NormalizeLabel(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
 
 type Table struct {
 	Headers []TextNode
 	Rows    [][]TextNode
+	Label   string // for cross references, see Ref
+	Number  string // set by transform.CrossReferences if labelled
 }
 
-func (t *Table) HTML() string {
-	var out strings.Builder
-	out.WriteString(`<table style="width:100%">`)
-	out.WriteString("\n<tr>\n")
-	for _, x := range t.Headers {
-		fmt.Fprintf(&out, "<th> %s </th>\n", x.textHTML())
-	}
-	out.WriteString("</tr>\n")
-	for _, row := range t.Rows {
-		out.WriteString("<tr>\n")
-		for _, x := range row {
-			fmt.Fprintf(&out, "<td> %s </td>\n", x.textHTML())
-		}
-		out.WriteString("</tr>\n")
-	}
-	out.WriteString("</table>")
-	return out.String()
-}
+func (t *Table) BlockNode() {}
 
 type Code struct {
-	Text string
+	Text   string
+	Label  string // for cross references, see Ref
+	Number string // set by transform.CrossReferences if labelled
 }
 
-func (c *Code) HTML() string {
-	return fmt.Sprintf("<pre><code>%s</code></pre>",
-		escape(c.Text))
-}
-
-func (c *Code) textHTML() string { return c.HTML() }
-func (c *Code) listHTML() string { return c.HTML() }
-func (c *Code) Bare() string     { return c.Text }
+func (c *Code) BlockNode()   {}
+func (c *Code) InlineNode()  {}
+func (c *Code) Bare() string { return c.Text }
 
 type Video struct {
 	Source string
 	Attrs  map[string]string // not implemented
 }
 
-func (v *Video) HTML() string {
-	return fmt.Sprintf("<video><source src=%q></video>", v.Source)
-}
+func (v *Video) BlockNode() {}
 
 type Image struct {
-	Attrs map[string]string
+	Attrs  map[string]string
+	Label  string // for cross references, see Ref
+	Number string // set by transform.CrossReferences if labelled
 }
 
-func (img *Image) HTML() string {
-	var out strings.Builder
-	out.WriteString("<img")
-	for key, val := range img.Attrs {
-		fmt.Fprintf(&out, " %s=%q", key, val)
-	}
-	out.WriteRune('>')
-	return out.String()
-}
+func (img *Image) BlockNode() {}
 
 type BlockQuote struct {
-	Text TextNode
+	Blocks      []Node
+	Attribution TextNode // may be nil
+	Cite        string   // URL of the source
 }
 
-func (bq *BlockQuote) Bare() string { return bq.Text.Bare() }
-func (bq *BlockQuote) HTML() string {
-	return fmt.Sprintf("<blockquote> %s </blockquote>",
-		bq.Text.textHTML())
+func (bq *BlockQuote) BlockNode() {}
+
+type Callout struct {
+	Kind   string   // note, tip, warning, danger...
+	Title  TextNode // may be nil
+	Blocks []Node
 }
 
-func (bq *BlockQuote) textHTML() string {
-	return fmt.Sprintf("<blockquote> %s </blockquote>", bq.Text.textHTML())
+func (c *Callout) BlockNode() {}
+
+// Math is a TeX formula, inline or displayed as a block.
+type Math struct {
+	TeX     string
+	Display bool
 }
 
-func (bq *BlockQuote) listHTML() string {
-	return fmt.Sprintf("<blockquote> %s </blockquote>", bq.Text.listHTML())
+func (m *Math) BlockNode()   {}
+func (m *Math) InlineNode()  {}
+func (m *Math) Bare() string { return m.TeX }
+
+// Ignore is the text of an ignore block, which is left out of the output.
+// It is kept so the document can be printed back, see package printer.
+type Ignore struct {
+	Text string
 }
 
+func (*Ignore) BlockNode() {}
+
 type ThemeBreak struct{}
 
-func (*ThemeBreak) HTML() string { return "<hr>" }
+func (*ThemeBreak) BlockNode() {}
 
 type LineBreak struct{}
 
-func (*LineBreak) HTML() string     { return "<br>" }
-func (*LineBreak) textHTML() string { return "<br>" }
-func (*LineBreak) Bare() string     { return "" }
+func (*LineBreak) BlockNode()   {}
+func (*LineBreak) Bare() string { return "" }
 
-type InlineCode struct {
-	Text string
+// Ref is a cross reference, written "[@label]", to the heading, table,
+// image or code block preceded by "@label{label}". It is replaced by a
+// link to it by transform.CrossReferences.
+type Ref struct {
+	Label string
 }
 
-func (c *InlineCode) textHTML() string {
-	return fmt.Sprintf("<code> %s </code>", escape(c.Text))
+func (*Ref) InlineNode()    {}
+func (r *Ref) Bare() string { return r.Label }
+
+type InlineCode struct {
+	Text string
 }
 
-func (c *InlineCode) listHTML() string { return c.textHTML() }
-func (c *InlineCode) Bare() string     { return c.Text }
+func (c *InlineCode) InlineNode()  {}
+func (c *InlineCode) Bare() string { return c.Text }
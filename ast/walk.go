@@ -0,0 +1,55 @@
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order,
+// calling f for node and each of its children.
+// If f returns false, the children of that node are not visited.
+func Inspect(node interface{}, f func(interface{}) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	switch n := node.(type) {
+	case *TextBlock:
+		for _, x := range n.Items {
+			Inspect(x, f)
+		}
+	case *Heading:
+		Inspect(n.Title, f)
+	case *OrderedList:
+		for _, x := range n.Items {
+			Inspect(x, f)
+		}
+	case *UnorderedList:
+		for _, x := range n.Items {
+			Inspect(x, f)
+		}
+	case *Anchor:
+		Inspect(n.Text, f)
+	case *Table:
+		for _, x := range n.Headers {
+			Inspect(x, f)
+		}
+		for _, row := range n.Rows {
+			for _, x := range row {
+				Inspect(x, f)
+			}
+		}
+	case *ListItem:
+		for _, x := range n.Blocks {
+			Inspect(x, f)
+		}
+	case *BlockQuote:
+		for _, x := range n.Blocks {
+			Inspect(x, f)
+		}
+		if n.Attribution != nil {
+			Inspect(n.Attribution, f)
+		}
+	case *Callout:
+		if n.Title != nil {
+			Inspect(n.Title, f)
+		}
+		for _, x := range n.Blocks {
+			Inspect(x, f)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+// Package astjson converts typeup documents to and from JSON, so tools
+// not written in Go can read, generate or transform them.
+//
+// Every node is an object whose "type" member is the name of its type in
+// package ast, such as "Heading" or "TextBlock". The other members are
+// the fields of the node in lower camel case; empty fields are left out.
+// Blocks, such as the contents of a list item, are arrays of nodes and
+// inline text is an array of nodes under "inlines":
+//
+//	{"type": "Heading", "level": 2, "id": "usage",
+//		"title": {"type": "TextBlock", "inlines": [{"type": "Text", "text": "Usage"}]}}
+//
+// The style of Text is one of "bold", "italic" or "bold-italic". The text
+// of an Anchor is under "content" and the title of an Anchor or LinkDef
+// under "linkTitle", as "title" holds nodes.
+// Lists hold their items under "items", each item being an array of blocks.
+package astjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"github.com/insomnimus/typeup/parser"
+	"sort"
+	"strings"
+)
+
+// Document is a parsed document along with where its top level nodes
+// came from and the warnings of the parser.
+type Document struct {
+	Meta  map[string]string
+	Nodes []ast.Node
+	// Ranges holds the source range of each node in Nodes.
+	// It is nil for documents not parsed from typeup.
+	Ranges   []Range
+	Warnings []Warning
+}
+
+// Position is a location in the source document. Offset counts runes
+// from the start of the document, Line and Column count from 1.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Range is the part of the source a node was parsed from; End is exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Warning struct {
+	Position
+	Message string `json:"message"`
+}
+
+// FromSource parses the typeup document src.
+func FromSource(src string) *Document {
+	src = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(src)
+	var (
+		lines = []int{0}
+		doc   = []rune(src)
+	)
+	for i, c := range doc {
+		if c == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	position := func(offset int) Position {
+		ln := sort.SearchInts(lines, offset+1) - 1
+		return Position{Offset: offset, Line: ln + 1, Column: offset - lines[ln] + 1}
+	}
+
+	d := &Document{Meta: make(map[string]string)}
+	for _, b := range parser.Blocks(src) {
+		for k, v := range b.Meta {
+			d.Meta[k] = v
+		}
+		for _, w := range b.Warnings {
+			d.Warnings = append(d.Warnings, Warning{position(w.Pos()), w.Message()})
+		}
+		if b.Node != nil {
+			d.Nodes = append(d.Nodes, b.Node)
+			d.Ranges = append(d.Ranges, Range{position(b.Start), position(b.End)})
+		}
+	}
+	return d
+}
+
+type document struct {
+	Meta     map[string]string `json:"meta"`
+	Blocks   []*node           `json:"blocks"`
+	Warnings []Warning         `json:"warnings,omitempty"`
+}
+
+type node struct {
+	Type        string            `json:"type"`
+	Range       *Range            `json:"range,omitempty"`
+	Style       string            `json:"style,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	Level       int               `json:"level,omitempty"`
+	ID          string            `json:"id,omitempty"`
+	IsTitle     bool              `json:"isTitle,omitempty"`
+	Unnumbered  bool              `json:"unnumbered,omitempty"`
+	URL         string            `json:"url,omitempty"`
+	Source      string            `json:"source,omitempty"`
+	Cite        string            `json:"cite,omitempty"`
+	Kind        string            `json:"kind,omitempty"`
+	TeX         string            `json:"tex,omitempty"`
+	Display     bool              `json:"display,omitempty"`
+	Attrs       map[string]string `json:"attrs,omitempty"`
+	Title       *node             `json:"title,omitempty"`
+	Content     *node             `json:"content,omitempty"` // the text of an Anchor
+	LinkTitle   string            `json:"linkTitle,omitempty"`
+	Ref         string            `json:"ref,omitempty"`
+	Label       string            `json:"label,omitempty"`
+	Number      string            `json:"number,omitempty"`
+	Attribution *node             `json:"attribution,omitempty"`
+	Inlines     []*node           `json:"inlines,omitempty"`
+	Blocks      []*node           `json:"blocks,omitempty"`
+	Items       [][]*node         `json:"items,omitempty"`
+	Headers     []*node           `json:"headers,omitempty"`
+	Rows        [][]*node         `json:"rows,omitempty"`
+}
+
+var styles = map[ast.TextStyle]string{
+	ast.Bold:          "bold",
+	ast.Italic:        "italic",
+	ast.BoldAndItalic: "bold-italic",
+}
+
+// Marshal returns d as indented JSON.
+func Marshal(d *Document) ([]byte, error) {
+	out := document{Meta: d.Meta, Warnings: d.Warnings}
+	if out.Meta == nil {
+		out.Meta = map[string]string{}
+	}
+	out.Blocks = make([]*node, len(d.Nodes))
+	for i, n := range d.Nodes {
+		out.Blocks[i] = encode(n)
+		if i < len(d.Ranges) {
+			out.Blocks[i].Range = &d.Ranges[i]
+		}
+	}
+	return json.MarshalIndent(out, "", "\t")
+}
+
+// MarshalNodes returns nodes as a JSON array.
+func MarshalNodes(nodes []ast.Node) ([]byte, error) {
+	out := make([]*node, len(nodes))
+	for i, n := range nodes {
+		out[i] = encode(n)
+	}
+	return json.Marshal(out)
+}
+
+func encode(n interface{}) *node {
+	switch n := n.(type) {
+	case *ast.Text:
+		return &node{Type: "Text", Style: styles[n.Style], Text: n.Text}
+	case *ast.TextBlock:
+		out := &node{Type: "TextBlock"}
+		for _, x := range n.Items {
+			out.Inlines = append(out.Inlines, encode(x))
+		}
+		return out
+	case *ast.Heading:
+		return &node{Type: "Heading", Level: n.Level, ID: n.ID, IsTitle: n.IsTitle, Unnumbered: n.Unnumbered, Label: n.Label, Number: n.Number, Title: encode(n.Title)}
+	case *ast.UnorderedList:
+		return &node{Type: "UnorderedList", Items: encodeItems(n.Items)}
+	case *ast.OrderedList:
+		return &node{Type: "OrderedList", Items: encodeItems(n.Items)}
+	case *ast.Anchor:
+		return &node{Type: "Anchor", URL: n.URL, LinkTitle: n.Title, Ref: n.Ref, Content: encode(n.Text)}
+	case *ast.Table:
+		out := &node{Type: "Table", Label: n.Label, Number: n.Number, Headers: encodeInlines(n.Headers)}
+		for _, r := range n.Rows {
+			out.Rows = append(out.Rows, encodeInlines(r))
+		}
+		return out
+	case *ast.Code:
+		return &node{Type: "Code", Text: n.Text, Label: n.Label, Number: n.Number}
+	case *ast.InlineCode:
+		return &node{Type: "InlineCode", Text: n.Text}
+	case *ast.Video:
+		return &node{Type: "Video", Source: n.Source, Attrs: n.Attrs}
+	case *ast.Image:
+		return &node{Type: "Image", Attrs: n.Attrs, Label: n.Label, Number: n.Number}
+	case *ast.BlockQuote:
+		out := &node{Type: "BlockQuote", Cite: n.Cite, Blocks: encodeBlocks(n.Blocks)}
+		if n.Attribution != nil {
+			out.Attribution = encode(n.Attribution)
+		}
+		return out
+	case *ast.Callout:
+		out := &node{Type: "Callout", Kind: n.Kind, Blocks: encodeBlocks(n.Blocks)}
+		if n.Title != nil {
+			out.Title = encode(n.Title)
+		}
+		return out
+	case *ast.Math:
+		return &node{Type: "Math", TeX: n.TeX, Display: n.Display}
+	case *ast.Ignore:
+		return &node{Type: "Ignore", Text: n.Text}
+	case *ast.ThemeBreak:
+		return &node{Type: "ThemeBreak"}
+	case *ast.LineBreak:
+		return &node{Type: "LineBreak"}
+	case *ast.LinkDef:
+		return &node{Type: "LinkDef", Label: n.Label, URL: n.URL, LinkTitle: n.Title}
+	case *ast.Ref:
+		return &node{Type: "Ref", Label: n.Label}
+	default:
+		// nodes of parser extensions, which Unmarshal can not restore
+		return &node{Type: strings.TrimPrefix(fmt.Sprintf("%T", n), "*")}
+	}
+}
+
+func encodeBlocks(nodes []ast.Node) []*node {
+	out := make([]*node, len(nodes))
+	for i, x := range nodes {
+		out[i] = encode(x)
+	}
+	return out
+}
+
+func encodeInlines(nodes []ast.TextNode) []*node {
+	out := make([]*node, len(nodes))
+	for i, x := range nodes {
+		out[i] = encode(x)
+	}
+	return out
+}
+
+func encodeItems(items []*ast.ListItem) [][]*node {
+	out := make([][]*node, len(items))
+	for i, x := range items {
+		out[i] = encodeBlocks(x.Blocks)
+	}
+	return out
+}
+
+// Unmarshal rebuilds a document from the JSON written by Marshal.
+func Unmarshal(data []byte) (*Document, error) {
+	var in document
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, err
+	}
+	nodes, err := decodeBlocks(in.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	d := &Document{Meta: in.Meta, Nodes: nodes, Warnings: in.Warnings}
+	if d.Meta == nil {
+		d.Meta = make(map[string]string)
+	}
+	for _, n := range in.Blocks {
+		if n.Range == nil {
+			d.Ranges = nil
+			break
+		}
+		d.Ranges = append(d.Ranges, *n.Range)
+	}
+	return d, nil
+}
+
+// UnmarshalNodes rebuilds nodes from a JSON array of nodes.
+func UnmarshalNodes(data []byte) ([]ast.Node, error) {
+	var in []*node
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, err
+	}
+	return decodeBlocks(in)
+}
+
+func decode(n *node) (interface{}, error) {
+	if n == nil {
+		return nil, fmt.Errorf("null node")
+	}
+	switch n.Type {
+	case "Text":
+		style := ast.TextStyle(ast.NoStyle)
+		if n.Style != "" {
+			found := false
+			for k, v := range styles {
+				if v == n.Style {
+					style, found = k, true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unknown text style %q", n.Style)
+			}
+		}
+		return &ast.Text{Style: style, Text: n.Text}, nil
+	case "TextBlock":
+		items, err := decodeInlines(n.Inlines)
+		return &ast.TextBlock{Items: items}, err
+	case "Heading":
+		if n.Title == nil {
+			return nil, fmt.Errorf("Heading without a title")
+		}
+		title, err := decodeInline(n.Title)
+		return &ast.Heading{Title: title, Level: n.Level, ID: n.ID, IsTitle: n.IsTitle, Unnumbered: n.Unnumbered, Label: n.Label, Number: n.Number}, err
+	case "UnorderedList":
+		items, err := decodeItems(n.Items)
+		return &ast.UnorderedList{Items: items}, err
+	case "OrderedList":
+		items, err := decodeItems(n.Items)
+		return &ast.OrderedList{Items: items}, err
+	case "Anchor":
+		if n.Content == nil {
+			return nil, fmt.Errorf("Anchor without content")
+		}
+		text, err := decodeInline(n.Content)
+		return &ast.Anchor{Text: text, URL: n.URL, Title: n.LinkTitle, Ref: n.Ref}, err
+	case "Table":
+		t := &ast.Table{Label: n.Label, Number: n.Number}
+		var err error
+		if t.Headers, err = decodeInlines(n.Headers); err != nil {
+			return nil, err
+		}
+		for _, r := range n.Rows {
+			row, err := decodeInlines(r)
+			if err != nil {
+				return nil, err
+			}
+			t.Rows = append(t.Rows, row)
+		}
+		return t, nil
+	case "Code":
+		return &ast.Code{Text: n.Text, Label: n.Label, Number: n.Number}, nil
+	case "InlineCode":
+		return &ast.InlineCode{Text: n.Text}, nil
+	case "Video":
+		return &ast.Video{Source: n.Source, Attrs: n.Attrs}, nil
+	case "Image":
+		attrs := n.Attrs
+		if attrs == nil {
+			attrs = make(map[string]string)
+		}
+		return &ast.Image{Attrs: attrs, Label: n.Label, Number: n.Number}, nil
+	case "BlockQuote":
+		blocks, err := decodeBlocks(n.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		q := &ast.BlockQuote{Blocks: blocks, Cite: n.Cite}
+		if n.Attribution != nil {
+			if q.Attribution, err = decodeInline(n.Attribution); err != nil {
+				return nil, err
+			}
+		}
+		return q, nil
+	case "Callout":
+		blocks, err := decodeBlocks(n.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		c := &ast.Callout{Kind: n.Kind, Blocks: blocks}
+		if n.Title != nil {
+			if c.Title, err = decodeInline(n.Title); err != nil {
+				return nil, err
+			}
+		}
+		return c, nil
+	case "Math":
+		return &ast.Math{TeX: n.TeX, Display: n.Display}, nil
+	case "Ignore":
+		return &ast.Ignore{Text: n.Text}, nil
+	case "ThemeBreak":
+		return &ast.ThemeBreak{}, nil
+	case "LineBreak":
+		return &ast.LineBreak{}, nil
+	case "LinkDef":
+		return &ast.LinkDef{Label: n.Label, URL: n.URL, Title: n.LinkTitle}, nil
+	case "Ref":
+		return &ast.Ref{Label: n.Label}, nil
+	default:
+		return nil, fmt.Errorf("unknown node type %q", n.Type)
+	}
+}
+
+func decodeBlock(n *node) (ast.Node, error) {
+	x, err := decode(n)
+	if err != nil {
+		return nil, err
+	}
+	if b, ok := x.(ast.Node); ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("%s is not a block", n.Type)
+}
+
+func decodeInline(n *node) (ast.TextNode, error) {
+	x, err := decode(n)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := x.(ast.TextNode); ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("%s is not inline text", n.Type)
+}
+
+func decodeBlocks(nodes []*node) ([]ast.Node, error) {
+	var out []ast.Node
+	for _, x := range nodes {
+		b, err := decodeBlock(x)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func decodeInlines(nodes []*node) ([]ast.TextNode, error) {
+	var out []ast.TextNode
+	for _, x := range nodes {
+		t, err := decodeInline(x)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func decodeItems(items [][]*node) ([]*ast.ListItem, error) {
+	var out []*ast.ListItem
+	for _, x := range items {
+		blocks, err := decodeBlocks(x)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &ast.ListItem{Blocks: blocks})
+	}
+	return out, nil
+}
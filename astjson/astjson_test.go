@@ -0,0 +1,143 @@
+package astjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/insomnimus/typeup/transpiler"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func html(t *testing.T, d *transpiler.Document) string {
+	t.Helper()
+	if _, err := d.Apply(nil); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := d.WriteHTML(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("..", "example.tup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(FromSource(string(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := html(t, transpiler.Parse(string(src)))
+	got := html(t, &transpiler.Document{Nodes: d.Nodes, Meta: d.Meta})
+	if got != want {
+		t.Errorf("the HTML of the decoded document differs\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	// encoding the decoded document gives the same JSON
+	again, err := Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, data) {
+		t.Errorf("encoding the decoded document changed it\nfirst:\n%s\nsecond:\n%s", data, again)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	d := FromSource("# Title\n\nsome text\n\n[* a\n]\n")
+	want := []Range{
+		{Position{0, 1, 1}, Position{7, 1, 8}},
+		{Position{7, 1, 8}, Position{20, 5, 1}},
+		{Position{20, 5, 1}, Position{27, 7, 1}},
+	}
+	if len(d.Ranges) != len(d.Nodes) {
+		t.Fatalf("%d ranges for %d nodes", len(d.Ranges), len(d.Nodes))
+	}
+	if len(d.Ranges) != len(want) {
+		t.Fatalf("got ranges %v, want %v", d.Ranges, want)
+	}
+	for i, r := range d.Ranges {
+		if r != want[i] {
+			t.Errorf("node %d: got range %v, want %v", i, r, want[i])
+		}
+	}
+
+	data, err := Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Blocks []struct {
+			Range *Range `json:"range"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range doc.Blocks {
+		if b.Range == nil || *b.Range != want[i] {
+			t.Errorf("block %d: got range %v in the JSON, want %v", i, b.Range, want[i])
+		}
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	d := FromSource("text\n\n```\nunterminated code\n")
+	if len(d.Warnings) == 0 {
+		t.Fatal("no warnings")
+	}
+	w := d.Warnings[0]
+	// the code block is found to be unterminated at the end
+	if w.Message == "" || w.Offset != 28 || w.Line != 5 || w.Column != 1 {
+		t.Errorf("got warning %+v, want one at 5:1", w)
+	}
+	data, err := Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"warnings"`) {
+		t.Errorf("the warnings are not in the JSON:\n%s", data)
+	}
+	back, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Warnings) != len(d.Warnings) || back.Warnings[0] != w {
+		t.Errorf("got warnings %+v, want %+v", back.Warnings, d.Warnings)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		json, err string
+	}{
+		{`{"blocks": [`, "unexpected end of JSON input"},
+		{`{"blocks": {}}`, "cannot unmarshal"},
+		{`{"blocks": [null]}`, "null node"},
+		{`{"blocks": [{"type": "Paragraph"}]}`, `unknown node type "Paragraph"`},
+		{`{"blocks": [{"type": "TextBlock", "inlines": [{"type": "Text", "style": "underline"}]}]}`, `unknown text style "underline"`},
+		{`{"blocks": [{"type": "Anchor", "url": "x", "content": {"type": "Text", "text": "x"}}]}`, "Anchor is not a block"},
+		{`{"blocks": [{"type": "TextBlock", "inlines": [{"type": "Anchor", "url": "x"}]}]}`, "Anchor without content"},
+		{`{"blocks": [{"type": "TextBlock", "inlines": [{"type": "ThemeBreak"}]}]}`, "ThemeBreak is not inline text"},
+		{`{"blocks": [{"type": "TextBlock", "inlines": [{"type": "Video"}]}]}`, "Video is not inline text"},
+	}
+	for _, tt := range tests {
+		_, err := Unmarshal([]byte(tt.json))
+		if err == nil {
+			t.Errorf("%s: no error, want %q", tt.json, tt.err)
+		} else if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %q, want %q", tt.json, err, tt.err)
+		}
+	}
+	if _, err := UnmarshalNodes([]byte(`[{"type": "Nope"}]`)); err == nil {
+		t.Error("UnmarshalNodes: no error for an unknown type")
+	}
+}
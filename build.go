@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"github.com/insomnimus/typeup/site"
+	"github.com/insomnimus/typeup/watch"
+	"log"
+	"os"
+	"runtime"
+	"time"
+)
+
+func runBuild(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: typeup build [options] <srcdir> <outdir>\n"))
+		fs.PrintDefaults()
+	}
+	workers := fs.Int("j", runtime.NumCPU(), "number of documents to render in parallel")
+	watching := fs.Bool("watch", false, "keep running and rebuild documents as they change")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check for changes in watch mode")
+	mathFlag(fs)
+	configFlag(fs)
+	numberFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	b := &site.Builder{
+		Src:     fs.Arg(0),
+		Dst:     fs.Arg(1),
+		Workers: *workers,
+		Stderr:  os.Stderr,
+		Passes:  pipeline(),
+	}
+	if err := b.Build(); err != nil {
+		if !*watching {
+			log.Fatal(err)
+		}
+		log.Println(err)
+	}
+	if !*watching {
+		return
+	}
+
+	w := &watch.Watcher{
+		Interval: *interval,
+		List:     b.Sources,
+	}
+	log.Printf("watching %s for changes", b.Src)
+	err := w.Run(func(changed []string) {
+		if err := b.Update(changed); err != nil {
+			log.Println(err)
+		}
+	})
+	log.Fatal(err)
+}
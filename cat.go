@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/insomnimus/typeup/ansi"
+	"github.com/insomnimus/typeup/plaintext"
+	"github.com/insomnimus/typeup/transpiler"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+func runCat(args []string) {
+	fs := flag.NewFlagSet("cat", flag.ExitOnError)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: typeup cat [flags] [file ...]\n"))
+		fs.PrintDefaults()
+	}
+	width := fs.Int("width", 0, "line width; 0 fits the terminal")
+	color := fs.String("color", "auto", "when to style the output: auto, always or never")
+	configFlag(fs)
+	numberFlag(fs)
+	fs.Parse(args)
+
+	styled := false
+	switch *color {
+	case "always":
+		styled = true
+	case "never":
+	case "auto":
+		styled = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb"
+	default:
+		log.Fatalf("invalid -color %q", *color)
+	}
+	if *width <= 0 {
+		*width = terminalWidth(os.Stdout)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	render := func(r io.Reader, name string) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		d := transpiler.Parse(string(data))
+		for _, w := range d.Warnings {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, w)
+		}
+		warnings, err := d.Apply(pipeline())
+		if err != nil {
+			return err
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, w)
+		}
+		if styled {
+			return ansi.Fprint(out, d.Nodes, *width)
+		}
+		return plaintext.Fprint(out, d.Nodes, *width)
+	}
+
+	if fs.NArg() == 0 {
+		if err := render(os.Stdin, "<standard input>"); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for i, name := range fs.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		err = render(f, name)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalWidth returns the width of the terminal f is connected to,
+// falling back to $COLUMNS and then 80.
+func terminalWidth(f *os.File) int {
+	if w := termWidth(f); w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 80
+}
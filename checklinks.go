@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/insomnimus/typeup/linkcheck"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func runCheckLinks(args []string) {
+	fs := flag.NewFlagSet("check-links", flag.ExitOnError)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: typeup check-links [flags] [path ...]\n"))
+		fs.PrintDefaults()
+	}
+	external := fs.Bool("external", false, "check http and https links too")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for each external link")
+	configFlag(fs)
+	fs.Parse(args)
+
+	c := &linkcheck.Checker{Passes: passes}
+	if *external {
+		c.Client = &http.Client{Timeout: *timeout}
+	}
+	broken := false
+	report := func(name string, diags []linkcheck.Diagnostic) {
+		for _, d := range diags {
+			if d.Range.Start.Line == 0 {
+				fmt.Printf("%s: %s\n", name, d)
+			} else {
+				fmt.Printf("%s:%s\n", name, d)
+			}
+			broken = true
+		}
+	}
+
+	if fs.NArg() == 0 {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		diags, err := c.Check(string(data), ".")
+		if err != nil {
+			log.Fatal(err)
+		}
+		report("<standard input>", diags)
+	}
+	for _, arg := range fs.Args() {
+		err := filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || path != arg && !strings.HasSuffix(path, ".tup") {
+				return nil
+			}
+			diags, err := c.CheckFile(path)
+			if err != nil {
+				return err
+			}
+			report(path, diags)
+			return nil
+		})
+		if err != nil {
+			log.Println(err)
+			broken = true
+		}
+	}
+	if broken {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+)
+
+func runConvert(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: typeup convert [flags] [input [output]]\n\nConvert a document between formats, by default from Markdown to typeup.\nWhat can not be converted is reported on stderr.\n"))
+		fs.PrintDefaults()
+	}
+	from := fs.String("from", "markdown", "input format: "+strings.Join(inputNames(), ", "))
+	to := fs.String("to", "typeup", "output format: "+strings.Join(formatNames(), ", "))
+	fs.IntVar(&textWidth, "width", textWidth, "line width of text output")
+	configFlag(fs)
+	numberFlag(fs)
+	fs.Parse(args)
+
+	if output = formats[*to]; output == nil {
+		log.Fatalf("unknown output format %q", *to)
+	}
+	if input = inputs[*from]; input == nil {
+		log.Fatalf("unknown input format %q", *from)
+	}
+	var err error
+	switch fs.NArg() {
+	case 0:
+		err = convert(os.Stdin, os.Stdout)
+	case 1:
+		err = convertFile(fs.Arg(0), "")
+	case 2:
+		err = convertFile(fs.Arg(0), fs.Arg(1))
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
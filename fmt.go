@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/insomnimus/typeup/printer"
+	"github.com/insomnimus/typeup/transpiler"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runFmt(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: typeup fmt [flags] [path ...]\n"))
+		fs.PrintDefaults()
+	}
+	write := fs.Bool("w", false, "write result to (source) file instead of stdout")
+	list := fs.Bool("l", false, "list files whose formatting differs from typeup fmt's")
+	diff := fs.Bool("d", false, "display diffs instead of rewriting files")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		if *write || *list {
+			log.Fatal("-w and -l need file arguments")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		src := string(data)
+		res := format(src, "<standard input>")
+		if *diff {
+			fmt.Print(unifiedDiff("<standard input>", src, res))
+		} else {
+			fmt.Print(res)
+		}
+		return
+	}
+
+	failed := false
+	for _, arg := range fs.Args() {
+		err := filepath.WalkDir(arg, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || path != arg && !strings.HasSuffix(path, ".tup") {
+				return nil
+			}
+			return fmtFile(path, *write, *list, *diff)
+		})
+		if err != nil {
+			log.Println(err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func fmtFile(path string, write, list, diff bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	src := string(data)
+	res := format(src, path)
+	if !write && !list && !diff {
+		_, err = io.WriteString(os.Stdout, res)
+		return err
+	}
+	if res == src {
+		return nil
+	}
+	if list {
+		fmt.Println(path)
+	}
+	if diff {
+		fmt.Print(unifiedDiff(path, src, res))
+	}
+	if write {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(res), info.Mode().Perm())
+	}
+	return nil
+}
+
+func format(src, name string) string {
+	doc := transpiler.Parse(src)
+	for _, w := range doc.Warnings {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, w)
+	}
+	var buf bytes.Buffer
+	printer.Fprint(&buf, doc.Nodes, doc.Meta)
+	return buf.String()
+}
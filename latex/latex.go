@@ -0,0 +1,308 @@
+// Package latex renders typeup documents as LaTeX.
+package latex
+
+import (
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var escaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"{", `\{`,
+	"}", `\}`,
+	"$", `\$`,
+	"&", `\&`,
+	"#", `\#`,
+	"_", `\_`,
+	"%", `\%`,
+	"~", `\textasciitilde{}`,
+	"^", `\textasciicircum{}`,
+)
+
+// Escape returns s with the characters special to LaTeX escaped.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// urlEscaper escapes the characters \href and \url can not take as is.
+var urlEscaper = strings.NewReplacer(`\`, `\\`, "#", `\#`, "%", `\%`, "{", `\{`, "}", `\}`)
+
+const preamble = `\documentclass{article}
+\usepackage[utf8]{inputenc}
+\usepackage[T1]{fontenc}
+\usepackage{amsmath}
+\usepackage{graphicx}
+\usepackage{listings}
+\usepackage{caption}
+\usepackage{hyperref}
+\lstset{basicstyle=\ttfamily\small, breaklines=true}
+`
+
+// Fprint writes nodes as a complete LaTeX document to w.
+// The title, author and date keys of meta fill in the title block.
+func Fprint(w io.Writer, nodes []ast.Node, meta map[string]string) error {
+	_, err := io.WriteString(w, Print(nodes, meta))
+	return err
+}
+
+// Print returns nodes as a complete LaTeX document.
+func Print(nodes []ast.Node, meta map[string]string) string {
+	var out strings.Builder
+	out.WriteString(preamble)
+	title, hasTitle := meta["title"]
+	if hasTitle {
+		fmt.Fprintf(&out, "\\title{%s}\n", Escape(title))
+		fmt.Fprintf(&out, "\\author{%s}\n", Escape(meta["author"]))
+		fmt.Fprintf(&out, "\\date{%s}\n", Escape(meta["date"]))
+	}
+	out.WriteString("\n\\begin{document}\n")
+	if hasTitle {
+		out.WriteString("\\maketitle\n")
+	}
+	for _, n := range nodes {
+		// the title is set with \maketitle
+		if h, ok := n.(*ast.Heading); ok && h.IsTitle && hasTitle {
+			continue
+		}
+		if s := block(n); s != "" {
+			out.WriteString("\n" + s + "\n")
+		}
+	}
+	out.WriteString("\n\\end{document}\n")
+	return out.String()
+}
+
+var sections = []string{"section", "subsection", "subsubsection", "paragraph", "subparagraph", "subparagraph"}
+
+func blocks(nodes []ast.Node) string {
+	var out []string
+	for _, n := range nodes {
+		if s := block(n); s != "" {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "\n\n")
+}
+
+func block(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		return strings.TrimSpace(inline(n))
+	case *ast.Heading:
+		if n.IsTitle {
+			return fmt.Sprintf("{\\centering\\LARGE %s\\par}", inline(n.Title))
+		}
+		level := n.Level
+		if level < 1 {
+			level = 1
+		} else if level > len(sections) {
+			level = len(sections)
+		}
+		// LaTeX does not number the sections itself, so the numbers
+		// agree with the ones given by the numbering pass and the
+		// text of cross references
+		title := strings.TrimSpace(inline(n.Title))
+		if n.Number != "" {
+			title = n.Number + " " + title
+		}
+		s := fmt.Sprintf("\\%s*{%s}", sections[level-1], title)
+		if n.ID != "" {
+			// starred sections make no anchor for \hyperref
+			s = fmt.Sprintf("\\phantomsection%s\\label{%s}", s, n.ID)
+		}
+		return s
+	case *ast.UnorderedList:
+		return list("itemize", n.Items)
+	case *ast.OrderedList:
+		return list("enumerate", n.Items)
+	case *ast.Table:
+		return table(n)
+	case *ast.Code:
+		return code(n)
+	case *ast.Image:
+		return image(n)
+	case *ast.Video:
+		return fmt.Sprintf("Video: \\url{%s}", urlEscaper.Replace(n.Source))
+	case *ast.BlockQuote:
+		s := "\\begin{quote}\n" + blocks(n.Blocks)
+		if n.Attribution != nil || n.Cite != "" {
+			s += "\n\n\\hfill---"
+			if n.Attribution != nil {
+				s += " " + strings.TrimSpace(inline(n.Attribution))
+			}
+			if n.Cite != "" {
+				s += fmt.Sprintf(" \\url{%s}", urlEscaper.Replace(n.Cite))
+			}
+		}
+		return s + "\n\\end{quote}"
+	case *ast.Callout:
+		head := Escape(n.Kind)
+		if r, size := utf8.DecodeRuneInString(head); size > 0 {
+			head = string(unicode.ToUpper(r)) + head[size:]
+		}
+		if n.Title != nil {
+			head += ": " + strings.TrimSpace(inline(n.Title))
+		}
+		return fmt.Sprintf("\\begin{quote}\n\\textbf{%s}\n\n%s\n\\end{quote}", head, blocks(n.Blocks))
+	case *ast.Math:
+		// align makes its own display
+		if strings.HasPrefix(n.TeX, `\begin{align`) {
+			return n.TeX
+		}
+		return "\\[\n" + n.TeX + "\n\\]"
+	case *ast.ThemeBreak:
+		return "\\begin{center}\\rule{0.5\\linewidth}{0.4pt}\\end{center}"
+	default:
+		return ""
+	}
+}
+
+func inline(n ast.TextNode) string {
+	switch n := n.(type) {
+	case *ast.Text:
+		switch n.Style {
+		case ast.Bold:
+			return fmt.Sprintf("\\textbf{%s}", Escape(n.Text))
+		case ast.Italic:
+			return fmt.Sprintf("\\textit{%s}", Escape(n.Text))
+		case ast.BoldAndItalic:
+			return fmt.Sprintf("\\textbf{\\textit{%s}}", Escape(n.Text))
+		default:
+			return Escape(n.Text)
+		}
+	case *ast.TextBlock:
+		var items []string
+		for _, x := range n.Items {
+			if s := inline(x); s != "" {
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, " ")
+	case *ast.Anchor:
+		text := strings.TrimSpace(inline(n.Text))
+		if strings.HasPrefix(n.URL, "#") {
+			return fmt.Sprintf("\\hyperref[%s]{%s}", n.URL[1:], text)
+		}
+		if text == "" || n.Text.Bare() == n.URL {
+			return fmt.Sprintf("\\url{%s}", urlEscaper.Replace(n.URL))
+		}
+		return fmt.Sprintf("\\href{%s}{%s}", urlEscaper.Replace(n.URL), text)
+	case *ast.InlineCode:
+		return fmt.Sprintf("\\texttt{%s}", Escape(n.Text))
+	case *ast.Code:
+		return fmt.Sprintf("\\texttt{%s}", Escape(strings.TrimSpace(n.Text)))
+	case *ast.Math:
+		if n.Display {
+			return "\\[" + n.TeX + "\\]"
+		}
+		return "\\(" + n.TeX + "\\)"
+	default:
+		return Escape(n.Bare())
+	}
+}
+
+func list(env string, items []*ast.ListItem) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "\\begin{%s}\n", env)
+	for _, x := range items {
+		s := blocks(x.Blocks)
+		if s == "" {
+			out.WriteString("\\item\n")
+		} else {
+			out.WriteString("\\item " + s + "\n")
+		}
+	}
+	fmt.Fprintf(&out, "\\end{%s}", env)
+	return out.String()
+}
+
+func table(t *ast.Table) string {
+	cols := len(t.Headers)
+	for _, r := range t.Rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+	if cols == 0 {
+		return ""
+	}
+	row := func(cells []ast.TextNode, bold bool) string {
+		out := make([]string, len(cells))
+		for i, x := range cells {
+			out[i] = strings.TrimSpace(inline(x))
+			if bold && out[i] != "" {
+				out[i] = "\\textbf{" + out[i] + "}"
+			}
+		}
+		return strings.Join(out, " & ") + " \\\\\n"
+	}
+
+	var out strings.Builder
+	// labelled tables are numbered like the cross references to them;
+	// an empty caption is printed as just "Table 1"
+	if t.Label != "" {
+		fmt.Fprintf(&out, "\\begin{table}[htbp]\n\\centering\n\\caption{}\\label{%s}\n", t.Label)
+	} else {
+		out.WriteString("\\begin{center}\n")
+	}
+	fmt.Fprintf(&out, "\\begin{tabular}{%s}\n\\hline\n", strings.Repeat("l", cols))
+	out.WriteString(row(t.Headers, true))
+	out.WriteString("\\hline\n")
+	for _, r := range t.Rows {
+		out.WriteString(row(r, false))
+	}
+	out.WriteString("\\hline\n\\end{tabular}\n")
+	if t.Label != "" {
+		out.WriteString("\\end{table}")
+	} else {
+		out.WriteString("\\end{center}")
+	}
+	return out.String()
+}
+
+func code(c *ast.Code) string {
+	text := strings.Trim(c.Text, "\n")
+	env := "lstlisting"
+	if strings.Contains(text, `\end{lstlisting}`) {
+		env = "verbatim"
+	}
+	s := fmt.Sprintf("\\begin{%s}\n%s\n\\end{%[1]s}", env, text)
+	if c.Label == "" {
+		return s
+	}
+	return fmt.Sprintf("\\begin{minipage}{\\linewidth}\n\\captionof{lstlisting}{}\\label{%s}\n%s\n\\end{minipage}", c.Label, s)
+}
+
+func image(img *ast.Image) string {
+	src := img.Attrs["src"]
+	alt := strings.TrimSpace(img.Attrs["alt"])
+	// LaTeX can only include local files, remote ones are linked to
+	remote := strings.Contains(src, "://")
+	if remote && img.Label == "" {
+		if alt == "" {
+			return fmt.Sprintf("\\url{%s}", urlEscaper.Replace(src))
+		}
+		return fmt.Sprintf("%s: \\url{%s}", Escape(alt), urlEscaper.Replace(src))
+	}
+	var out strings.Builder
+	out.WriteString("\\begin{figure}[htbp]\n\\centering\n")
+	if remote {
+		fmt.Fprintf(&out, "\\url{%s}\n", urlEscaper.Replace(src))
+	} else {
+		// \detokenize keeps the underscores and such of file names
+		fmt.Fprintf(&out, "\\includegraphics[width=\\linewidth,keepaspectratio]{\\detokenize{%s}}\n", src)
+	}
+	// only labelled figures are numbered, like the cross references to them
+	switch {
+	case img.Label != "":
+		fmt.Fprintf(&out, "\\caption{%s}\\label{%s}\n", Escape(alt), img.Label)
+	case alt != "":
+		fmt.Fprintf(&out, "\\caption*{%s}\n", Escape(alt))
+	}
+	out.WriteString("\\end{figure}")
+	return out.String()
+}
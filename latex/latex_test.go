@@ -0,0 +1,36 @@
+package latex
+
+import (
+	"github.com/insomnimus/typeup/transpiler"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.tup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test data")
+	}
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := os.ReadFile(strings.TrimSuffix(path, ".tup") + ".tex")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := transpiler.Parse(string(src))
+		if _, err := d.Apply(nil); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if got := blocks(d.Nodes) + "\n"; got != string(expected) {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", path, got, expected)
+		}
+	}
+}
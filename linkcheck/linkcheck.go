@@ -0,0 +1,236 @@
+// Package linkcheck finds the broken links and images of typeup documents.
+package linkcheck
+
+import (
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"github.com/insomnimus/typeup/astjson"
+	"github.com/insomnimus/typeup/transform"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Diagnostic is a link that can not be followed.
+type Diagnostic struct {
+	// Range is that of the URL in the source. For links whose URL is not
+	// written in the block holding them, such as reference links and
+	// cross references, it is that of the top level block instead. It is
+	// the zero Range for blocks added by transform passes.
+	Range   astjson.Range
+	URL     string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.Range.Start.Line == 0 {
+		return fmt.Sprintf("link to %q: %s", d.URL, d.Message)
+	}
+	return fmt.Sprintf("%d:%d: link to %q: %s", d.Range.Start.Line, d.Range.Start.Column, d.URL, d.Message)
+}
+
+// Checker checks the targets of the links and images of documents:
+// that local files exist and that fragments name a heading or labelled
+// block of the document they point into. Absolute paths are not
+// checked, as they depend on where the documents are served from.
+type Checker struct {
+	// Passes run after transform.Defaults, before the links are checked.
+	Passes transform.Pipeline
+	// Client checks http and https links if it is not nil.
+	Client *http.Client
+
+	ids      map[string]map[string]bool // by path of .tup documents
+	external map[string]string          // results of external links
+}
+
+// CheckFile checks the links of the typeup document at path.
+func (c *Checker) CheckFile(path string) ([]Diagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.Check(string(data), filepath.Dir(path))
+}
+
+// Check checks the links of the typeup document src, resolving relative
+// paths against dir.
+func (c *Checker) Check(src, dir string) ([]Diagnostic, error) {
+	d := astjson.FromSource(src)
+	doc := []rune(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(src))
+	ranges := make(map[ast.Node]astjson.Range, len(d.Nodes))
+	for i, n := range d.Nodes {
+		r := d.Ranges[i]
+		// blocks start after the end of the previous one
+		for ; r.Start.Offset < len(doc) && unicode.IsSpace(doc[r.Start.Offset]); r.Start.Offset++ {
+			if doc[r.Start.Offset] == '\n' {
+				r.Start.Line++
+				r.Start.Column = 0
+			}
+			r.Start.Column++
+		}
+		ranges[n] = r
+	}
+	td := &transform.Document{Nodes: d.Nodes, Meta: d.Meta}
+	pl := append(transform.Defaults[:len(transform.Defaults):len(transform.Defaults)], c.Passes...)
+	if err := pl.Run(td); err != nil {
+		return nil, err
+	}
+	ids := idsOf(td.Nodes)
+
+	var diags []Diagnostic
+	for _, n := range td.Nodes {
+		var (
+			r = ranges[n]
+			// where to look for the next URL in the source
+			from = r.Start
+		)
+		check := func(link string) {
+			at := r
+			if found, ok := find(doc, link, from, r.End.Offset); ok {
+				at, from = found, found.End
+			}
+			if msg := c.check(link, dir, ids); msg != "" {
+				diags = append(diags, Diagnostic{Range: at, URL: link, Message: msg})
+			}
+		}
+		ast.Inspect(n, func(n interface{}) bool {
+			switch n := n.(type) {
+			case *ast.Anchor:
+				check(n.URL)
+			case *ast.Image:
+				check(n.Attrs["src"])
+			}
+			return true
+		})
+	}
+	return diags, nil
+}
+
+// find returns the range of the first s in doc between from and the
+// offset end, if there is one.
+func find(doc []rune, s string, from astjson.Position, end int) (astjson.Range, bool) {
+	if s == "" || from.Offset >= end || end > len(doc) {
+		return astjson.Range{}, false
+	}
+	text := string(doc[from.Offset:end])
+	i := strings.Index(text, s)
+	if i < 0 {
+		return astjson.Range{}, false
+	}
+	start := advance(doc, from, from.Offset+utf8.RuneCountInString(text[:i]))
+	return astjson.Range{Start: start, End: advance(doc, start, start.Offset+utf8.RuneCountInString(s))}, true
+}
+
+// advance returns the position at offset, which is not before p.
+func advance(doc []rune, p astjson.Position, offset int) astjson.Position {
+	for ; p.Offset < offset; p.Offset++ {
+		if doc[p.Offset] == '\n' {
+			p.Line++
+			p.Column = 1
+		} else {
+			p.Column++
+		}
+	}
+	return p
+}
+
+// check returns what is wrong with link, or "" if nothing is. ids are
+// those of the document holding the link.
+func (c *Checker) check(link, dir string, ids map[string]bool) string {
+	u, err := url.Parse(link)
+	switch {
+	case err != nil:
+		return "malformed URL"
+	case u.Scheme == "http" || u.Scheme == "https":
+		if c.Client == nil {
+			return ""
+		}
+		return c.checkExternal(link)
+	case u.Scheme != "" || u.Host != "" || strings.HasPrefix(u.Path, "/"):
+		return ""
+	case u.Path == "":
+		if u.Fragment != "" && !ids[u.Fragment] {
+			return "no heading or label has this id"
+		}
+		return ""
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(u.Path))
+	if _, err := os.Stat(path); err != nil {
+		return "no such file"
+	}
+	if u.Fragment == "" || !strings.HasSuffix(path, ".tup") {
+		return ""
+	}
+	if c.ids == nil {
+		c.ids = make(map[string]map[string]bool)
+	}
+	if c.ids[path] == nil {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err.Error()
+		}
+		c.ids[path] = idsOf(astjson.FromSource(string(data)).Nodes)
+	}
+	if !c.ids[path][u.Fragment] {
+		return fmt.Sprintf("no heading or label of %s has the id %q", u.Path, u.Fragment)
+	}
+	return ""
+}
+
+// checkExternal requests link, once per Checker.
+func (c *Checker) checkExternal(link string) string {
+	if msg, ok := c.external[link]; ok {
+		return msg
+	}
+	if c.external == nil {
+		c.external = make(map[string]string)
+	}
+	msg := ""
+	resp, err := c.Client.Head(link)
+	// some servers do not allow HEAD
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = c.Client.Get(link)
+	}
+	if err != nil {
+		msg = err.Error()
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			msg = resp.Status
+		}
+	}
+	c.external[link] = msg
+	return msg
+}
+
+// idsOf returns the HTML ids of the headings and labelled blocks in nodes.
+func idsOf(nodes []ast.Node) map[string]bool {
+	ids := make(map[string]bool)
+	add := func(id string) {
+		if id != "" {
+			ids[id] = true
+		}
+	}
+	for _, n := range nodes {
+		ast.Inspect(n, func(n interface{}) bool {
+			switch n := n.(type) {
+			case *ast.Heading:
+				add(n.ID)
+			case *ast.Table:
+				add(n.Label)
+			case *ast.Image:
+				add(n.Label)
+			case *ast.Code:
+				add(n.Label)
+			}
+			return true
+		})
+	}
+	return ids
+}
@@ -0,0 +1,63 @@
+package linkcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPositions(t *testing.T) {
+	const src = "# Title\n\nline one\nline two\nline three\nsee [broken missing.tup] and [again missing.tup]\n"
+	c := &Checker{}
+	diags, err := c.Check(src, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]int{{6, 13}, {6, 37}}
+	if len(diags) != len(want) {
+		t.Fatalf("got %d diagnostics, want %d: %v", len(diags), len(want), diags)
+	}
+	for i, d := range diags {
+		if got := [2]int{d.Range.Start.Line, d.Range.Start.Column}; got != want[i] {
+			t.Errorf("diagnostic %d is at %d:%d, want %d:%d", i, got[0], got[1], want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestExternal(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.Handle("/moved", http.RedirectHandler("/ok", http.StatusMovedPermanently))
+	mux.Handle("/moved-missing", http.RedirectHandler("/missing", http.StatusFound))
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path   string
+		broken bool
+	}{
+		{"/ok", false},
+		{"/missing", true},
+		{"/moved", false},
+		{"/moved-missing", true},
+		{"/slow", true},
+	}
+	c := &Checker{Client: &http.Client{Timeout: 200 * time.Millisecond}}
+	for _, tt := range tests {
+		diags, err := c.Check("see ["+srv.URL+tt.path+"]\n", ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if broken := len(diags) > 0; broken != tt.broken {
+			t.Errorf("%s: got broken = %t, want %t: %v", tt.path, broken, tt.broken, diags)
+		}
+	}
+}
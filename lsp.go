@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"github.com/insomnimus/typeup/lsp"
+	"log"
+	"os"
+)
+
+func runLSP(args []string) {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: typeup lsp\nRuns a language server on stdin and stdout.\n"))
+	}
+	fs.Parse(args)
+	if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,131 @@
+package lsp
+
+import (
+	"github.com/insomnimus/typeup/parser"
+	"strings"
+	"unicode/utf8"
+)
+
+var newlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+type document struct {
+	uri    string
+	text   []rune
+	lines  []int // offsets of the line starts
+	blocks []*parser.Block
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri}
+	d.set(text)
+	return d
+}
+
+func (d *document) set(text string) {
+	text = newlines.Replace(text)
+	d.text = []rune(text)
+	d.blocks = parser.Blocks(text)
+	d.index()
+}
+
+// edit replaces the text in r with text and updates the parsed blocks
+// incrementally.
+func (d *document) edit(r rng, text string) {
+	start, end := d.offset(r.Start), d.offset(r.End)
+	if end < start {
+		start, end = end, start
+	}
+	ins := []rune(newlines.Replace(text))
+	buf := make([]rune, 0, len(d.text)-(end-start)+len(ins))
+	buf = append(buf, d.text[:start]...)
+	buf = append(buf, ins...)
+	buf = append(buf, d.text[end:]...)
+	d.text = buf
+	d.blocks = parser.Reparse(d.blocks, string(buf), start, end, len(ins))
+	d.index()
+}
+
+func (d *document) index() {
+	d.lines = append(d.lines[:0], 0)
+	for i, c := range d.text {
+		if c == '\n' {
+			d.lines = append(d.lines, i+1)
+		}
+	}
+}
+
+// offset converts an LSP position, which counts UTF-16 code units,
+// to a rune offset.
+func (d *document) offset(pos position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lines) {
+		return len(d.text)
+	}
+	i := d.lines[pos.Line]
+	for n := 0; i < len(d.text) && d.text[i] != '\n'; i++ {
+		n += utf16Len(d.text[i])
+		if n > pos.Character {
+			break
+		}
+	}
+	return i
+}
+
+func (d *document) position(offset int) position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	// find the last line starting at or before offset
+	lo, hi := 0, len(d.lines)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if d.lines[mid] <= offset {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	col := 0
+	for _, c := range d.text[d.lines[lo]:offset] {
+		col += utf16Len(c)
+	}
+	return position{Line: lo, Character: col}
+}
+
+func (d *document) rangeOf(start, end int) rng {
+	return rng{Start: d.position(start), End: d.position(end)}
+}
+
+// line returns the text of the line containing offset and the offset
+// of its start.
+func (d *document) line(offset int) (string, int) {
+	pos := d.position(offset)
+	start := d.lines[pos.Line]
+	end := len(d.text)
+	if pos.Line+1 < len(d.lines) {
+		end = d.lines[pos.Line+1] - 1
+	}
+	return string(d.text[start:end]), start
+}
+
+func (d *document) meta() map[string]string {
+	m := make(map[string]string)
+	for _, b := range d.blocks {
+		for k, v := range b.Meta {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+func utf16Len(c rune) int {
+	if c >= 0x10000 && utf8.ValidRune(c) {
+		return 2
+	}
+	return 1
+}
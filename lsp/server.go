@@ -0,0 +1,366 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/insomnimus/typeup/ast"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// metaKeys are the meta data keys with a meaning to typeup, offered as
+// completions in meta blocks.
+var metaKeys = map[string]string{
+	"title":     "The document title, also set by a `=#` heading.",
+	"author":    "The author of the document.",
+	"date":      "The date of the document.",
+	"lang":      "The language of the document.",
+	"autolink":  "Set to `off` to keep URLs and email addresses in text from becoming links.",
+	"numbering": "Set to `on` to number the headings, or `off` to leave them unnumbered.",
+}
+
+type server struct {
+	conn     *conn
+	docs     map[string]*document
+	shutdown bool
+}
+
+// Serve runs a language server speaking the protocol over r and w
+// until the client asks it to exit or the connection is closed.
+func Serve(r io.Reader, w io.Writer) error {
+	s := &server{
+		conn: newConn(r, w),
+		docs: make(map[string]*document),
+	}
+	for {
+		msg, err := s.conn.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err = s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *server) handle(msg *message) error {
+	if msg.ID == nil {
+		return s.handleNotification(msg)
+	}
+
+	var result interface{}
+	switch msg.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    syncIncremental,
+				},
+				"documentSymbolProvider": true,
+				"foldingRangeProvider":   true,
+				"definitionProvider":     true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"{"},
+				},
+			},
+			"serverInfo": map[string]string{"name": "typeup"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/documentSymbol":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.conn.replyError(msg.ID, codeInvalidParams, "%v", err)
+		}
+		if d, ok := s.docs[params.TextDocument.URI]; ok {
+			result = outline(d)
+		}
+	case "textDocument/foldingRange":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.conn.replyError(msg.ID, codeInvalidParams, "%v", err)
+		}
+		if d, ok := s.docs[params.TextDocument.URI]; ok {
+			result = folding(d)
+		}
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.conn.replyError(msg.ID, codeInvalidParams, "%v", err)
+		}
+		if d, ok := s.docs[params.TextDocument.URI]; ok {
+			if loc, ok := s.definition(d, params.Position); ok {
+				result = loc
+			}
+		}
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.conn.replyError(msg.ID, codeInvalidParams, "%v", err)
+		}
+		if d, ok := s.docs[params.TextDocument.URI]; ok {
+			result = completion(d, params.Position)
+		}
+	default:
+		return s.conn.replyError(msg.ID, codeMethodNotFound, "method not supported: %s", msg.Method)
+	}
+	return s.conn.reply(msg.ID, result)
+}
+
+func (s *server) handleNotification(msg *message) error {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		d := newDocument(params.TextDocument.URI, params.TextDocument.Text)
+		s.docs[d.uri] = d
+		return s.publishDiagnostics(d)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		d, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil
+		}
+		for _, c := range params.ContentChanges {
+			if c.Range == nil {
+				d.set(c.Text)
+			} else {
+				d.edit(*c.Range, c.Text)
+			}
+		}
+		return s.publishDiagnostics(d)
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []diagnostic{},
+		})
+	}
+	return nil
+}
+
+func (s *server) publishDiagnostics(d *document) error {
+	diags := []diagnostic{}
+	for _, b := range d.blocks {
+		for _, w := range b.Warnings {
+			diags = append(diags, diagnostic{
+				Range:    d.rangeOf(w.Pos(), w.Pos()+1),
+				Severity: severityWarning,
+				Source:   "typeup",
+				Message:  w.Message(),
+			})
+		}
+	}
+	return s.conn.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         d.uri,
+		Diagnostics: diags,
+	})
+}
+
+// outline returns the headings of the document as nested symbols.
+// A heading's range covers its whole section.
+func outline(d *document) []documentSymbol {
+	type section struct {
+		sym   documentSymbol
+		level int
+	}
+	var (
+		root  []documentSymbol
+		stack []*section
+	)
+	closeTo := func(level, end int) {
+		for len(stack) > 0 && stack[len(stack)-1].level >= level {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			top.sym.Range.End = d.position(end)
+			if len(stack) == 0 {
+				root = append(root, top.sym)
+			} else {
+				parent := &stack[len(stack)-1].sym
+				parent.Children = append(parent.Children, top.sym)
+			}
+		}
+	}
+	for _, b := range d.blocks {
+		h, ok := b.Node.(*ast.Heading)
+		if !ok {
+			continue
+		}
+		closeTo(h.Level, b.Start)
+		r := d.rangeOf(b.Start, b.End)
+		stack = append(stack, &section{
+			level: h.Level,
+			sym: documentSymbol{
+				Name:           strings.TrimSpace(h.Title.Bare()),
+				Kind:           symbolString,
+				Range:          r,
+				SelectionRange: r,
+			},
+		})
+	}
+	closeTo(0, len(d.text))
+	if root == nil {
+		root = []documentSymbol{}
+	}
+	return root
+}
+
+func folding(d *document) []foldingRange {
+	ranges := []foldingRange{}
+	for _, b := range d.blocks {
+		switch b.Node.(type) {
+		case *ast.OrderedList, *ast.UnorderedList, *ast.Code, *ast.Table, *ast.BlockQuote, *ast.Callout:
+		default:
+			continue
+		}
+		start, end := d.position(b.Start).Line, d.position(b.End-1).Line
+		if end > start {
+			ranges = append(ranges, foldingRange{StartLine: start, EndLine: end})
+		}
+	}
+	return ranges
+}
+
+// definition resolves the link under pos to the heading or document it
+// points to.
+func (s *server) definition(d *document, pos position) (*location, bool) {
+	offset := d.offset(pos)
+	line, lineStart := d.line(offset)
+	target, ok := linkAt([]rune(line), offset-lineStart)
+	if !ok {
+		return nil, false
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "" && u.Scheme != "file" || u.Host != "" {
+		return nil, false
+	}
+
+	dst := d
+	if u.Path != "" {
+		base, err := url.Parse(d.uri)
+		if err != nil {
+			return nil, false
+		}
+		ref := base.ResolveReference(&url.URL{Path: u.Path})
+		if dst = s.docs[ref.String()]; dst == nil {
+			data, err := os.ReadFile(filepath.FromSlash(ref.Path))
+			if err != nil {
+				return nil, false
+			}
+			dst = newDocument(ref.String(), string(data))
+		}
+	}
+	if u.Fragment == "" {
+		return &location{URI: dst.uri, Range: dst.rangeOf(0, 0)}, true
+	}
+	for _, b := range dst.blocks {
+		if h, ok := b.Node.(*ast.Heading); ok && h.ID == u.Fragment {
+			return &location{URI: dst.uri, Range: dst.rangeOf(b.Start, b.End)}, true
+		}
+	}
+	return nil, false
+}
+
+// linkAt returns the target of the link syntax surrounding col in line.
+func linkAt(line []rune, col int) (string, bool) {
+	start, end := -1, -1
+	for i := col; i >= 0 && i < len(line); i-- {
+		if line[i] == '[' {
+			start = i
+			break
+		}
+		if line[i] == ']' && i != col {
+			return "", false
+		}
+	}
+	if start < 0 {
+		return "", false
+	}
+	for i := start + 1; i < len(line); i++ {
+		if line[i] == ']' {
+			end = i
+			break
+		}
+	}
+	if end < col {
+		return "", false
+	}
+	text := string(line[start+1 : end])
+	if i := strings.LastIndex(text, "|"); i >= 0 {
+		text = text[i+1:]
+	}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", false
+	}
+	return fields[len(fields)-1], true
+}
+
+// completion offers meta data keys when pos is at the start of an entry
+// in a meta block.
+func completion(d *document, pos position) []completionItem {
+	offset := d.offset(pos)
+	line, lineStart := d.line(offset)
+	before := string([]rune(line)[:offset-lineStart])
+	trimmed := strings.TrimSpace(before)
+	if strings.Contains(before, "=") {
+		return []completionItem{}
+	}
+	inMeta := strings.HasPrefix(trimmed, "@{")
+	if !inMeta && !strings.ContainsAny(trimmed, "{}") {
+		for ln := pos.Line - 1; ln >= 0; ln-- {
+			prev, _ := d.line(d.lines[ln])
+			prev = strings.TrimSpace(prev)
+			if prev == "@{" {
+				inMeta = true
+				break
+			}
+			if prev == "}" {
+				break
+			}
+		}
+	}
+	if !inMeta {
+		return []completionItem{}
+	}
+
+	keys := make(map[string]string, len(metaKeys))
+	for k := range d.meta() {
+		keys[k] = ""
+	}
+	for k, doc := range metaKeys {
+		keys[k] = doc
+	}
+	items := []completionItem{}
+	for k, doc := range keys {
+		items = append(items, completionItem{
+			Label:         k,
+			Kind:          completionProperty,
+			Detail:        "meta data",
+			Documentation: doc,
+			InsertText:    k + " = ",
+		})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
@@ -2,15 +2,139 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"github.com/insomnimus/typeup/astjson"
+	"github.com/insomnimus/typeup/latex"
+	"github.com/insomnimus/typeup/man"
+	"github.com/insomnimus/typeup/markdown"
+	"github.com/insomnimus/typeup/pandoc"
+	"github.com/insomnimus/typeup/plaintext"
+	"github.com/insomnimus/typeup/printer"
+	"github.com/insomnimus/typeup/render"
+	"github.com/insomnimus/typeup/transform"
 	"github.com/insomnimus/typeup/transpiler"
+	"github.com/insomnimus/typeup/watch"
 	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"time"
 )
 
+var commands = map[string]func(args []string){
+	"build":       runBuild,
+	"serve":       runServe,
+	"lsp":         runLSP,
+	"fmt":         runFmt,
+	"cat":         runCat,
+	"ast":         runAST,
+	"convert":     runConvert,
+	"check-links": runCheckLinks,
+}
+
+// formats are the output formats of the default command, by -to name.
+var formats = map[string]func(d *transpiler.Document, w io.Writer) error{
+	"html": (*transpiler.Document).WriteHTML,
+	"latex": func(d *transpiler.Document, w io.Writer) error {
+		return latex.Fprint(w, d.Nodes, d.Meta)
+	},
+	"man": func(d *transpiler.Document, w io.Writer) error {
+		return man.Fprint(w, d.Nodes, d.Meta)
+	},
+	"pandoc": func(d *transpiler.Document, w io.Writer) error {
+		return pandoc.Fprint(w, d.Nodes, d.Meta)
+	},
+	"text": func(d *transpiler.Document, w io.Writer) error {
+		return plaintext.Fprint(w, d.Nodes, textWidth)
+	},
+	"typeup": func(d *transpiler.Document, w io.Writer) error {
+		return printer.Fprint(w, d.Nodes, d.Meta)
+	},
+}
+
+// inputs are the input formats of the default command, by -from name.
+var inputs = map[string]func(src []byte) (*transpiler.Document, error){
+	"typeup": func(src []byte) (*transpiler.Document, error) {
+		return transpiler.Parse(string(src)), nil
+	},
+	"pandoc": func(src []byte) (*transpiler.Document, error) {
+		nodes, meta, err := pandoc.Unmarshal(src)
+		if err != nil {
+			return nil, err
+		}
+		return &transpiler.Document{Nodes: nodes, Meta: meta}, nil
+	},
+	"markdown": func(src []byte) (*transpiler.Document, error) {
+		nodes, meta, diags := markdown.Parse(string(src))
+		for _, d := range diags {
+			fmt.Fprintln(os.Stderr, d)
+		}
+		return &transpiler.Document{Nodes: nodes, Meta: meta}, nil
+	},
+	"json": func(src []byte) (*transpiler.Document, error) {
+		d, err := astjson.Unmarshal(src)
+		if err != nil {
+			return nil, err
+		}
+		return &transpiler.Document{Nodes: d.Nodes, Meta: d.Meta}, nil
+	},
+}
+
+// input is the input format selected with -from.
+var input = inputs["typeup"]
+
+// textWidth is the line width of text output, set with -width.
+var textWidth = 72
+
+// output is the output format selected with -to.
+var output = formats["html"]
+
+func formatNames() []string {
+	var names []string
+	for k := range formats {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func inputNames() []string {
+	var names []string
+	for k := range inputs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func main() {
 	log.SetFlags(0)
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+	watching := flag.Bool("watch", false, "keep running and convert the input again whenever it changes")
+	interval := flag.Duration("interval", 500*time.Millisecond, "how often to check for changes in watch mode")
+	from := flag.String("from", "typeup", "input format: "+strings.Join(inputNames(), ", "))
+	to := flag.String("to", "html", "output format: "+strings.Join(formatNames(), ", "))
+	flag.IntVar(&textWidth, "width", textWidth, "line width of text output")
+	mathFlag(flag.CommandLine)
+	configFlag(flag.CommandLine)
+	numberFlag(flag.CommandLine)
 	flag.Parse()
+	if output = formats[*to]; output == nil {
+		log.Fatalf("unknown output format %q", *to)
+	}
+	if input = inputs[*from]; input == nil {
+		log.Fatalf("unknown input format %q", *from)
+	}
+	if *watching {
+		watchFile(*interval)
+		return
+	}
 	var (
 		in  io.Reader
 		out io.Writer
@@ -42,8 +166,132 @@ func main() {
 		out = fo
 		defer fo.Close()
 	}
-	err = transpiler.ToHTML(in, out, os.Stderr)
+	err = convert(in, out)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// mathFlag adds the -math flag, which sets the math mode of transpiler.HTML, to fs.
+func mathFlag(fs *flag.FlagSet) {
+	fs.Var(mathMode{}, "math", "how to render math to HTML: mathml or katex")
+}
+
+// passes are the transform passes loaded with -config.
+var passes transform.Pipeline
+
+// configFlag adds the -config flag, which sets passes, to fs.
+func configFlag(fs *flag.FlagSet) {
+	usage := "JSON file listing the transform passes to run, out of " + strings.Join(transform.Names(), ", ")
+	fs.Func("config", usage, func(path string) (err error) {
+		passes, err = transform.LoadFile(path)
+		return err
+	})
+}
+
+// numberSections is set by -number-sections.
+var numberSections bool
+
+// numberFlag adds the -number-sections flag, which numbers the headings
+// of documents not setting the numbering meta data key, to fs.
+func numberFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&numberSections, "number-sections", numberSections, "number the headings, unless a document sets numbering = off")
+}
+
+// pipeline returns the passes to run after transform.Defaults, as set
+// by -config and -number-sections.
+func pipeline() transform.Pipeline {
+	if !numberSections {
+		return passes
+	}
+	return append(transform.Pipeline{transform.Numbering(true)}, passes...)
+}
+
+type mathMode struct{}
+
+func (mathMode) String() string {
+	if transpiler.HTML.MathMode == render.KaTeX {
+		return "katex"
+	}
+	return "mathml"
+}
+
+func (mathMode) Set(s string) error {
+	switch s {
+	case "mathml":
+		transpiler.HTML.MathMode = render.MathML
+	case "katex":
+		transpiler.HTML.MathMode = render.KaTeX
+	default:
+		return fmt.Errorf("unknown math mode %q", s)
+	}
+	return nil
+}
+
+func watchFile(interval time.Duration) {
+	if flag.NArg() == 0 {
+		log.Fatal("-watch needs an input file")
+	}
+	convert := func() {
+		if err := convertFile(flag.Arg(0), flag.Arg(1)); err != nil {
+			log.Println(err)
+		}
+	}
+	convert()
+	w := &watch.Watcher{
+		Interval: interval,
+		List:     watch.Files(flag.Arg(0)),
+	}
+	log.Printf("watching %s for changes", flag.Arg(0))
+	err := w.Run(func([]string) {
+		log.Printf("rebuilding %s", flag.Arg(0))
+		convert()
+	})
+	log.Fatal(err)
+}
+
+// convert writes the document read from in to out in the selected format,
+// printing the warnings to stderr.
+func convert(in io.Reader, out io.Writer) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	d, err := input(data)
+	if err != nil {
+		return err
+	}
+	for _, w := range d.Warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	warnings, err := d.Apply(pipeline())
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Fprintln(os.Stderr, w)
+	}
+	return output(d, out)
+}
+
+// convertFile converts the document at in to the selected format, writing to the file out
+// or to stdout if out is empty.
+func convertFile(in, out string) error {
+	fi, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	if out == "" {
+		return convert(fi, os.Stdout)
+	}
+	fo, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err = convert(fi, fo); err != nil {
+		fo.Close()
+		return err
+	}
+	return fo.Close()
+}
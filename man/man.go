@@ -0,0 +1,277 @@
+// Package man renders typeup documents as manual pages for the
+// groff man(7) macros.
+//
+// The .TH line is made of the meta data keys title, section (1 by default),
+// date, source and manual. Level 1 headings become .SH sections, deeper
+// ones .SS subsections.
+package man
+
+import (
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"io"
+	"strings"
+)
+
+var escaper = strings.NewReplacer(`\`, `\e`, "-", `\-`)
+
+// escape returns s with the characters special to roff escaped.
+// Lines starting with a control character are guarded with \&, and empty
+// lines, which roff prints, are removed.
+func escape(s string) string {
+	var lines []string
+	for _, ln := range strings.Split(escaper.Replace(s), "\n") {
+		ln = strings.TrimLeft(ln, " \t")
+		if ln == "" {
+			continue
+		}
+		if strings.HasPrefix(ln, ".") || strings.HasPrefix(ln, "'") {
+			ln = `\&` + ln
+		}
+		lines = append(lines, ln)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quote returns s as a macro argument.
+func quote(s string) string {
+	s = strings.ReplaceAll(escaper.Replace(strings.Join(strings.Fields(s), " ")), `"`, `\(dq`)
+	return `"` + s + `"`
+}
+
+// Fprint writes nodes as a manual page to w.
+func Fprint(w io.Writer, nodes []ast.Node, meta map[string]string) error {
+	_, err := io.WriteString(w, Print(nodes, meta))
+	return err
+}
+
+// Print returns nodes as a manual page.
+func Print(nodes []ast.Node, meta map[string]string) string {
+	var out strings.Builder
+	// ask man to run the document through tbl
+	for _, n := range nodes {
+		found := false
+		ast.Inspect(n, func(n interface{}) bool {
+			_, ok := n.(*ast.Table)
+			found = found || ok
+			return !found
+		})
+		if found {
+			out.WriteString("'\\\" t\n")
+			break
+		}
+	}
+	section := meta["section"]
+	if section == "" {
+		section = "1"
+	}
+	fmt.Fprintf(&out, ".TH %s %s %s %s %s\n",
+		quote(strings.ToUpper(meta["title"])), quote(section),
+		quote(meta["date"]), quote(meta["source"]), quote(meta["manual"]))
+	for _, n := range nodes {
+		if s := block(n); s != "" {
+			out.WriteString(s + "\n")
+		}
+	}
+	return out.String()
+}
+
+func blocks(nodes []ast.Node) string {
+	var out []string
+	for _, n := range nodes {
+		if s := block(n); s != "" {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func block(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		if s := inline(n); s != "" {
+			return ".PP\n" + s
+		}
+		return ""
+	case *ast.Heading:
+		switch {
+		case n.IsTitle:
+			// the title is on the .TH line
+			return ""
+		case n.Level == 1:
+			return ".SH " + quote(strings.TrimSpace(n.Number+" "+n.Title.Bare()))
+		default:
+			return ".SS " + quote(strings.TrimSpace(n.Number+" "+n.Title.Bare()))
+		}
+	case *ast.UnorderedList:
+		return list(n.Items, func(int) string { return `\(bu` }, 2)
+	case *ast.OrderedList:
+		return list(n.Items, func(i int) string { return fmt.Sprintf("%d.", i+1) }, 4)
+	case *ast.Table:
+		return captioned("Table", n.Number) + table(n)
+	case *ast.Code:
+		return captioned("Listing", n.Number) + ".PP\n" + code(n.Text)
+	case *ast.Image:
+		kind := "image"
+		if n.Number != "" {
+			kind = "Figure " + n.Number
+		}
+		if alt := strings.TrimSpace(n.Attrs["alt"]); alt != "" {
+			return ".PP\n" + escape(fmt.Sprintf("[%s: %s <%s>]", kind, alt, n.Attrs["src"]))
+		}
+		return ".PP\n" + escape(fmt.Sprintf("[%s: <%s>]", kind, n.Attrs["src"]))
+	case *ast.Video:
+		return ".PP\n" + escape(fmt.Sprintf("[video: <%s>]", n.Source))
+	case *ast.BlockQuote:
+		s := ".RS 4\n" + blocks(n.Blocks)
+		if n.Attribution != nil || n.Cite != "" {
+			s += "\n.PP\n\\(em"
+			if n.Attribution != nil {
+				s += " " + inline(n.Attribution)
+			}
+			if n.Cite != "" {
+				s += "\n.UR " + escaper.Replace(n.Cite) + "\n.UE"
+			}
+		}
+		return s + "\n.RE"
+	case *ast.Callout:
+		head := strings.ToUpper(n.Kind) + ":"
+		if n.Title != nil {
+			head += " " + strings.Join(strings.Fields(n.Title.Bare()), " ")
+		}
+		return ".PP\n\\fB" + escape(head) + "\\fR\n.RS 4\n" + blocks(n.Blocks) + "\n.RE"
+	case *ast.Math:
+		return ".PP\n" + code(n.TeX)
+	case *ast.ThemeBreak:
+		return ".PP\n.ce\n* * *"
+	default:
+		return ""
+	}
+}
+
+// inline returns n as roff text. Links are put on their own lines
+// as they use the .UR macro.
+func inline(n ast.TextNode) string {
+	switch n := n.(type) {
+	case *ast.Text:
+		text := escape(strings.TrimSpace(n.Text))
+		switch n.Style {
+		case ast.Bold:
+			return `\fB` + text + `\fR`
+		case ast.Italic:
+			return `\fI` + text + `\fR`
+		case ast.BoldAndItalic:
+			return `\f(BI` + text + `\fR`
+		default:
+			return text
+		}
+	case *ast.TextBlock:
+		var (
+			out     strings.Builder
+			newline = true
+		)
+		for _, x := range n.Items {
+			s := inline(x)
+			if s == "" {
+				continue
+			}
+			if _, ok := x.(*ast.Anchor); ok {
+				if !newline {
+					out.WriteString("\n")
+				}
+				out.WriteString(s + "\n")
+				newline = true
+				continue
+			}
+			if !newline {
+				out.WriteString(" ")
+			}
+			out.WriteString(s)
+			newline = false
+		}
+		return strings.TrimSuffix(out.String(), "\n")
+	case *ast.Anchor:
+		text := strings.Join(strings.Fields(n.Text.Bare()), " ")
+		if text == "" || text == n.URL {
+			return ".UR " + escaper.Replace(n.URL) + "\n.UE"
+		}
+		return ".UR " + escaper.Replace(n.URL) + "\n" + escape(text) + "\n.UE"
+	case *ast.InlineCode:
+		return `\fB` + escape(n.Text) + `\fR`
+	case *ast.Code:
+		return `\fB` + escape(strings.TrimSpace(n.Text)) + `\fR`
+	default:
+		return escape(strings.TrimSpace(n.Bare()))
+	}
+}
+
+func code(text string) string {
+	lines := strings.Split(strings.Trim(text, "\n"), "\n")
+	for i, ln := range lines {
+		ln = escaper.Replace(ln)
+		if strings.HasPrefix(ln, ".") || strings.HasPrefix(ln, "'") {
+			ln = `\&` + ln
+		}
+		lines[i] = ln
+	}
+	return ".RS 4\n.nf\n" + strings.Join(lines, "\n") + "\n.fi\n.RE"
+}
+
+func list(items []*ast.ListItem, marker func(i int) string, indent int) string {
+	var out []string
+	for i, x := range items {
+		out = append(out, fmt.Sprintf(".IP %s %d", marker(i), indent))
+		for j, b := range x.Blocks {
+			switch b := b.(type) {
+			case *ast.TextBlock:
+				if j > 0 {
+					out = append(out, fmt.Sprintf(`.IP "" %d`, indent))
+				}
+				out = append(out, inline(b))
+			default:
+				out = append(out, ".RS "+fmt.Sprint(indent), block(b), ".RE")
+			}
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// captioned returns the paragraph with the bold "Table 2" put before a
+// numbered block, or nothing for a block without a number.
+func captioned(kind, number string) string {
+	if number == "" {
+		return ""
+	}
+	return ".PP\n\\fB" + kind + " " + number + "\\fR\n"
+}
+
+func table(t *ast.Table) string {
+	cols := len(t.Headers)
+	for _, r := range t.Rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+	if cols == 0 {
+		return ""
+	}
+	row := func(cells []ast.TextNode) string {
+		out := make([]string, len(cells))
+		for i, x := range cells {
+			out[i] = strings.ReplaceAll(escape(strings.Join(strings.Fields(x.Bare()), " ")), "\t", " ")
+			if out[i] == "" {
+				out[i] = `\&`
+			}
+		}
+		return strings.Join(out, "\t")
+	}
+	var out []string
+	out = append(out, ".PP", ".TS", "tab(\t) allbox;",
+		strings.TrimSpace(strings.Repeat("lb ", cols)),
+		strings.TrimSpace(strings.Repeat("l ", cols))+".",
+		row(t.Headers))
+	for _, r := range t.Rows {
+		out = append(out, row(r))
+	}
+	return strings.Join(append(out, ".TE"), "\n")
+}
@@ -0,0 +1,37 @@
+package man
+
+import (
+	"github.com/insomnimus/typeup/transpiler"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrint(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.tup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test data")
+	}
+	meta := map[string]string{"title": "test", "date": "2024-01-01"}
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := os.ReadFile(strings.TrimSuffix(path, ".tup") + ".man")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := transpiler.Parse(string(src))
+		if _, err := d.Apply(nil); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if got := Print(d.Nodes, meta); got != string(expected) {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", path, got, expected)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package markdown
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	entityRe   = regexp.MustCompile(`^&(?:#[0-9]{1,7}|#[xX][0-9a-fA-F]{1,6}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+	autolinkRe = regexp.MustCompile(`^<([a-zA-Z][a-zA-Z0-9+.-]{1,31}:[^\s<>]*)>`)
+	emailRe    = regexp.MustCompile(`^<([a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9.-]*[a-zA-Z0-9])?)>`)
+	tagRe      = regexp.MustCompile(`^<(?:/?[a-zA-Z][a-zA-Z0-9-]*(?:\s+[^<>]*)?/?>|!--[\s\S]*?-->)`)
+)
+
+func isPunct(r rune) bool {
+	return r < 128 && unicode.IsPunct(r) || r < 128 && unicode.IsSymbol(r)
+}
+
+// unescape resolves the backslash escapes and entities of s.
+func unescape(s string) string {
+	if !strings.ContainsAny(s, `\&`) {
+		return s
+	}
+	var out strings.Builder
+	r := []rune(s)
+	for i := 0; i < len(r); i++ {
+		if r[i] == '\\' && i+1 < len(r) && isPunct(r[i+1]) {
+			i++
+		}
+		out.WriteRune(r[i])
+	}
+	return html.UnescapeString(out.String())
+}
+
+// inliner collects the text nodes of a span of inline Markdown.
+type inliner struct {
+	c     *converter
+	line  int // of the start of the source
+	items []ast.TextNode
+	text  strings.Builder
+	style ast.TextStyle
+}
+
+func (in *inliner) flush() {
+	if s := strings.TrimSpace(in.text.String()); s != "" {
+		in.items = append(in.items, &ast.Text{Style: in.style, Text: s})
+	}
+	in.text.Reset()
+}
+
+func (in *inliner) add(n ast.TextNode) {
+	in.flush()
+	in.items = append(in.items, n)
+}
+
+// inlines converts the inline Markdown in s, which starts at line num.
+func (c *converter) inlines(s string, num int) *ast.TextBlock {
+	in := &inliner{c: c, line: num}
+	in.parse([]rune(s), 0, ast.NoStyle)
+	in.flush()
+	return &ast.TextBlock{Items: in.items}
+}
+
+func (in *inliner) warn(s []rune, i int, format string, args ...interface{}) {
+	if in.line > 0 {
+		in.c.warn(in.line+strings.Count(string(s[:i]), "\n"), format, args...)
+	}
+}
+
+func combine(style ast.TextStyle, n int) ast.TextStyle {
+	bold := style == ast.Bold || style == ast.BoldAndItalic || n >= 2
+	italic := style == ast.Italic || style == ast.BoldAndItalic || n != 2
+	switch {
+	case bold && italic:
+		return ast.BoldAndItalic
+	case bold:
+		return ast.Bold
+	default:
+		return ast.Italic
+	}
+}
+
+// codeSpan returns the end of the code span starting at s[i], or -1.
+func codeSpan(s []rune, i int) (string, int) {
+	n := 0
+	for i+n < len(s) && s[i+n] == '`' {
+		n++
+	}
+	for j := i + n; j < len(s); j++ {
+		if s[j] != '`' {
+			continue
+		}
+		m := 0
+		for j+m < len(s) && s[j+m] == '`' {
+			m++
+		}
+		if m == n {
+			text := strings.ReplaceAll(string(s[i+n:j]), "\n", " ")
+			if len(text) > 2 && text[0] == ' ' && text[len(text)-1] == ' ' && strings.Trim(text, " ") != "" {
+				text = text[1 : len(text)-1]
+			}
+			return text, j + m
+		}
+		j += m - 1
+	}
+	return "", -1
+}
+
+// closer returns the start of the delimiter run closing the n delimiters
+// d opened before s[i], along with its end, or -1.
+func closer(s []rune, i int, d rune, n int) (int, int) {
+	for j := i; j < len(s); j++ {
+		switch {
+		case s[j] == '\\':
+			j++
+		case s[j] == '`':
+			if _, end := codeSpan(s, j); end > 0 {
+				j = end - 1
+			}
+		case s[j] == d:
+			m := 0
+			for j+m < len(s) && s[j+m] == d {
+				m++
+			}
+			// right flanking, and not within a word for '_'
+			if j > 0 && !unicode.IsSpace(s[j-1]) && m >= n && j > i &&
+				(d == '*' || j+m >= len(s) || !unicode.IsLetter(s[j+m]) && !unicode.IsDigit(s[j+m])) {
+				return j + m - n, j + m
+			}
+			j += m - 1
+		}
+	}
+	return -1, -1
+}
+
+func (in *inliner) parse(s []rune, i int, style ast.TextStyle) {
+	setStyle := func(st ast.TextStyle) {
+		if st != in.style {
+			in.flush()
+			in.style = st
+		}
+	}
+	setStyle(style)
+	for ; i < len(s); i++ {
+		r := s[i]
+		switch {
+		case r == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			in.text.WriteRune(s[i+1])
+			i++
+			continue
+		case r == '\\' && i+1 < len(s) && s[i+1] == '\n',
+			r == '\n' && i >= 2 && s[i-1] == ' ' && s[i-2] == ' ':
+			in.warn(s, i, "hard line break dropped")
+			if r == '\\' {
+				i++
+			}
+			in.text.WriteRune('\n')
+			continue
+		case r == '`':
+			if text, end := codeSpan(s, i); end > 0 {
+				in.add(&ast.InlineCode{Text: text})
+				i = end - 1
+				continue
+			}
+			for i+1 < len(s) && s[i+1] == '`' {
+				in.text.WriteRune('`')
+				i++
+			}
+		case r == '$' && i+1 < len(s) && !unicode.IsSpace(s[i+1]):
+			n := 1
+			if s[i+1] == '$' {
+				n = 2
+			}
+			if tex, end := math(s, i+n, n); end > 0 {
+				in.add(&ast.Math{TeX: tex, Display: n == 2})
+				i = end - 1
+				continue
+			}
+		case r == '!' && i+1 < len(s) && s[i+1] == '[':
+			if text, l, end, ok := in.c.link(s, i+1); ok {
+				in.warn(s, i, "inline image turned into a link")
+				alt := in.c.inlines(string(text), 0)
+				if len(alt.Items) == 0 {
+					alt.Items = []ast.TextNode{&ast.Text{Text: l.dest}}
+				}
+				in.add(&ast.Anchor{Text: alt, URL: l.dest, Title: l.title})
+				i = end - 1
+				continue
+			}
+		case r == '[' && i+1 < len(s) && s[i+1] == '^':
+			if end := indexRune(s, i, ']'); end > 0 {
+				in.warn(s, i, "footnote reference dropped")
+				i = end
+				continue
+			}
+		case r == '[':
+			if text, l, end, ok := in.c.link(s, i); ok {
+				sub := &inliner{c: in.c, line: in.line + strings.Count(string(s[:i]), "\n")}
+				sub.parse(text, 0, ast.NoStyle)
+				sub.flush()
+				in.add(&ast.Anchor{Text: &ast.TextBlock{Items: sub.items}, URL: l.dest, Title: l.title})
+				i = end - 1
+				continue
+			}
+		case r == '<':
+			rest := string(s[i:])
+			if m := autolinkRe.FindStringSubmatch(rest); m != nil {
+				in.add(&ast.Anchor{Text: &ast.TextBlock{Items: []ast.TextNode{&ast.Text{Text: m[1]}}}, URL: m[1]})
+				i += len([]rune(m[0])) - 1
+				continue
+			}
+			if m := emailRe.FindStringSubmatch(rest); m != nil {
+				in.add(&ast.Anchor{Text: &ast.TextBlock{Items: []ast.TextNode{&ast.Text{Text: m[1]}}}, URL: "mailto:" + m[1]})
+				i += len([]rune(m[0])) - 1
+				continue
+			}
+			if m := tagRe.FindString(rest); m != "" {
+				in.warn(s, i, "inline HTML %s dropped", m)
+				i += len([]rune(m)) - 1
+				continue
+			}
+		case r == '&':
+			if m := entityRe.FindString(string(s[i:])); m != "" {
+				in.text.WriteString(html.UnescapeString(m))
+				i += len(m) - 1
+				continue
+			}
+		case r == '~' && i+1 < len(s) && s[i+1] == '~':
+			if start, end := closer(s, i+2, '~', 2); start > 0 {
+				in.warn(s, i, "strikethrough dropped")
+				in.parse(s[:start], i+2, style)
+				setStyle(style)
+				i = end - 1
+				continue
+			}
+		case r == '*' || r == '_':
+			n := 0
+			for i+n < len(s) && s[i+n] == r {
+				n++
+			}
+			intraword := r == '_' && i > 0 && (unicode.IsLetter(s[i-1]) || unicode.IsDigit(s[i-1]))
+			if i+n < len(s) && !unicode.IsSpace(s[i+n]) && !intraword {
+				k := n
+				if k > 3 {
+					k = 3
+				}
+				if start, end := closer(s, i+n, r, k); start > 0 {
+					// the run may open more than we close, keep the rest as text
+					for x := k; x < n && i+x < start; x++ {
+						in.text.WriteRune(r)
+					}
+					in.parse(s[:start], i+n, combine(style, k))
+					setStyle(style)
+					i = end - 1
+					continue
+				}
+			}
+			for x := 1; x < n; x++ {
+				in.text.WriteRune(r)
+			}
+			in.text.WriteRune(r)
+			i += n - 1
+			continue
+		}
+		in.text.WriteRune(r)
+	}
+}
+
+func indexRune(s []rune, i int, r rune) int {
+	for ; i < len(s); i++ {
+		if s[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// math returns the TeX of the math starting at s[i], after n dollar signs,
+// and its end, or -1. Inline math can not end in a space.
+func math(s []rune, i, n int) (string, int) {
+	for j := i; j+n <= len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] != '$' || n == 2 && s[j+1] != '$' {
+			continue
+		}
+		if j == i || n == 1 && unicode.IsSpace(s[j-1]) {
+			return "", -1
+		}
+		return strings.TrimSpace(string(s[i:j])), j + n
+	}
+	return "", -1
+}
+
+// link parses the link whose text starts with the '[' at s[i], returning
+// its text, destination and the end of the link.
+func (c *converter) link(s []rune, i int) ([]rune, link, int, bool) {
+	depth := 0
+	j := i
+	for ; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			if _, end := codeSpan(s, j); end > 0 {
+				j = end - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if j >= len(s) {
+		return nil, link{}, 0, false
+	}
+	text := s[i+1 : j]
+	j++
+	// inline link
+	if j < len(s) && s[j] == '(' {
+		if l, end, ok := destination(s, j+1); ok {
+			return text, l, end, true
+		}
+	}
+	// full, collapsed and shortcut references
+	label := string(text)
+	end := j
+	if j < len(s) && s[j] == '[' {
+		k := j + 1
+		for k < len(s) && s[k] != ']' && s[k] != '[' {
+			k++
+		}
+		if k < len(s) && s[k] == ']' {
+			if k > j+1 {
+				label = string(s[j+1 : k])
+			}
+			end = k + 1
+		}
+	}
+	if l, ok := c.refs[ast.NormalizeLabel(label)]; ok {
+		return text, l, end, true
+	}
+	return nil, link{}, 0, false
+}
+
+// destination parses the destination and title of an inline link
+// starting at s[i], after the '('.
+func destination(s []rune, i int) (link, int, bool) {
+	skip := func() {
+		for i < len(s) && unicode.IsSpace(s[i]) {
+			i++
+		}
+	}
+	var l link
+	skip()
+	if i < len(s) && s[i] == '<' {
+		j := i + 1
+		for j < len(s) && s[j] != '>' && s[j] != '\n' {
+			j++
+		}
+		if j >= len(s) || s[j] != '>' {
+			return l, 0, false
+		}
+		l.dest = string(s[i+1 : j])
+		i = j + 1
+	} else {
+		depth, j := 0, i
+		for ; j < len(s) && !unicode.IsSpace(s[j]); j++ {
+			if s[j] == '\\' {
+				j++
+			} else if s[j] == '(' {
+				depth++
+			} else if s[j] == ')' {
+				if depth == 0 {
+					break
+				}
+				depth--
+			}
+		}
+		if j > len(s) {
+			j = len(s)
+		}
+		l.dest = string(s[i:j])
+		i = j
+	}
+	skip()
+	if i < len(s) && (s[i] == '"' || s[i] == '\'' || s[i] == '(') {
+		close := s[i]
+		if close == '(' {
+			close = ')'
+		}
+		j := i + 1
+		for j < len(s) && s[j] != close {
+			if s[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j >= len(s) {
+			return l, 0, false
+		}
+		l.title = unescape(string(s[i+1 : j]))
+		i = j + 1
+		skip()
+	}
+	if i >= len(s) || s[i] != ')' {
+		return l, 0, false
+	}
+	l.dest = unescape(l.dest)
+	return l, i + 1, true
+}
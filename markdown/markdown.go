@@ -0,0 +1,526 @@
+// Package markdown converts CommonMark documents, with the GitHub
+// extensions for tables, strikethrough, task lists and alerts, to typeup
+// nodes.
+//
+// Constructs typeup has no equivalent for, such as raw HTML, footnotes
+// and code block languages, are dropped or reduced to their text and
+// reported as diagnostics.
+package markdown
+
+import (
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"github.com/insomnimus/typeup/parser"
+	"regexp"
+	"strings"
+)
+
+// Diagnostic reports a construct of the source that could not be converted.
+type Diagnostic struct {
+	Line    int // counting from 1
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+}
+
+type line struct {
+	text string
+	num  int
+}
+
+type link struct {
+	dest, title string
+}
+
+type converter struct {
+	refs  map[string]link
+	ids   map[string]int
+	diags []Diagnostic
+}
+
+func (c *converter) warn(ln int, format string, args ...interface{}) {
+	c.diags = append(c.diags, Diagnostic{ln, fmt.Sprintf(format, args...)})
+}
+
+// Parse converts the Markdown document src. The keys of a YAML front
+// matter block are returned as meta data; only plain "key: value" lines
+// are understood.
+func Parse(src string) (nodes []ast.Node, meta map[string]string, diags []Diagnostic) {
+	src = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(src)
+	c := &converter{
+		refs: make(map[string]link),
+		ids:  make(map[string]int),
+	}
+	var lines []line
+	for i, s := range strings.Split(src, "\n") {
+		lines = append(lines, line{expandTabs(s), i + 1})
+	}
+	meta = make(map[string]string)
+	lines = c.frontMatter(lines, meta)
+	c.collectRefs(lines)
+	return c.blocks(lines), meta, c.diags
+}
+
+// expandTabs replaces the tabs in the indentation of s with spaces,
+// with tab stops every 4 columns.
+func expandTabs(s string) string {
+	col := 0
+	for i, r := range s {
+		switch r {
+		case ' ':
+			col++
+		case '\t':
+			col += 4 - col%4
+		default:
+			if col == i {
+				return s
+			}
+			return strings.Repeat(" ", col) + s[i:]
+		}
+	}
+	return strings.Repeat(" ", col)
+}
+
+func indentOf(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " "))
+}
+
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+var (
+	atxRe       = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	fenceRe     = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})(.*)$")
+	ruleRe      = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	setextRe    = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	quoteRe     = regexp.MustCompile(`^ {0,3}> ?`)
+	bulletRe    = regexp.MustCompile(`^ {0,3}([-+*])(?:[ \t]+|$)`)
+	orderedRe   = regexp.MustCompile(`^ {0,3}(\d{1,9})([.)])(?:[ \t]+|$)`)
+	htmlRe      = regexp.MustCompile(`^ {0,3}<(?:/?[a-zA-Z][a-zA-Z0-9-]*(?:[ \t/>]|$)|!--|\?|![A-Za-z])`)
+	refRe       = regexp.MustCompile(`^ {0,3}\[([^\]]+)\]:[ \t]*(<[^>]*>|\S+)(?:[ \t]+("[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+	footnoteRe  = regexp.MustCompile(`^ {0,3}\[\^[^\]]+\]:`)
+	delimRowRe  = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	mathRe      = regexp.MustCompile(`^ {0,3}\$\$`)
+	alertRe     = regexp.MustCompile(`^\[!([A-Za-z]+)\][ \t]*(.*)$`)
+	taskRe      = regexp.MustCompile(`^\[[ xX]\][ \t]`)
+	frontLineRe = regexp.MustCompile(`^([A-Za-z0-9_-]+):[ \t]*(.*)$`)
+)
+
+func (c *converter) frontMatter(lines []line, meta map[string]string) []line {
+	if len(lines) == 0 || strings.TrimRight(lines[0].text, " ") != "---" {
+		return lines
+	}
+	for i := 1; i < len(lines); i++ {
+		s := strings.TrimRight(lines[i].text, " ")
+		if s != "---" && s != "..." {
+			continue
+		}
+		for _, ln := range lines[1:i] {
+			if isBlank(ln.text) || strings.HasPrefix(ln.text, "#") {
+				continue
+			}
+			m := frontLineRe.FindStringSubmatch(ln.text)
+			if m == nil || m[2] == "" {
+				c.warn(ln.num, "front matter line not understood, dropped")
+				continue
+			}
+			v := strings.TrimSpace(m[2])
+			if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+				v = v[1 : len(v)-1]
+			}
+			meta[m[1]] = v
+		}
+		return lines[i+1:]
+	}
+	return lines
+}
+
+// collectRefs gathers the link reference definitions outside code blocks.
+func (c *converter) collectRefs(lines []line) {
+	fence := ""
+	for _, ln := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(ln.text), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if m := fenceRe.FindStringSubmatch(ln.text); m != nil {
+			fence = m[2]
+			continue
+		}
+		if m := refRe.FindStringSubmatch(ln.text); m != nil {
+			label := ast.NormalizeLabel(m[1])
+			if _, ok := c.refs[label]; ok {
+				continue
+			}
+			dest := strings.TrimSuffix(strings.TrimPrefix(m[2], "<"), ">")
+			title := m[3]
+			if len(title) >= 2 {
+				title = title[1 : len(title)-1]
+			}
+			c.refs[label] = link{unescape(dest), unescape(title)}
+		}
+	}
+}
+
+// startsBlock reports whether s begins a block that interrupts a paragraph.
+func startsBlock(s string) bool {
+	if isBlank(s) {
+		return true
+	}
+	if atxRe.MatchString(s) || fenceRe.MatchString(s) || ruleRe.MatchString(s) ||
+		quoteRe.MatchString(s) || htmlRe.MatchString(s) || mathRe.MatchString(s) ||
+		footnoteRe.MatchString(s) {
+		return true
+	}
+	// empty list items and ordered lists not starting at 1 can not
+	// interrupt a paragraph
+	if m := bulletRe.FindStringIndex(s); m != nil {
+		return !isBlank(s[m[1]:])
+	}
+	if m := orderedRe.FindStringSubmatchIndex(s); m != nil {
+		return s[m[2]:m[3]] == "1" && !isBlank(s[m[1]:])
+	}
+	return false
+}
+
+func (c *converter) blocks(lines []line) []ast.Node {
+	var out []ast.Node
+	for i := 0; i < len(lines); {
+		nodes, next := c.block(lines, i)
+		out = append(out, nodes...)
+		i = next
+	}
+	return out
+}
+
+// block converts the block starting at lines[i], returning the index
+// of the line after it.
+func (c *converter) block(lines []line, i int) ([]ast.Node, int) {
+	ln := lines[i]
+	s := ln.text
+	switch {
+	case isBlank(s):
+		return nil, i + 1
+	case indentOf(s) >= 4:
+		return c.indentedCode(lines, i)
+	case fenceRe.MatchString(s) && !strings.Contains(fenceRe.FindStringSubmatch(s)[3], "`"):
+		return c.fencedCode(lines, i)
+	case mathRe.MatchString(s):
+		return c.math(lines, i)
+	case atxRe.MatchString(s):
+		m := atxRe.FindStringSubmatch(s)
+		return []ast.Node{c.heading(len(m[1]), m[2], ln.num)}, i + 1
+	case ruleRe.MatchString(s):
+		return []ast.Node{&ast.ThemeBreak{}}, i + 1
+	case quoteRe.MatchString(s):
+		return c.quote(lines, i)
+	case bulletRe.MatchString(s) || orderedRe.MatchString(s):
+		return c.list(lines, i)
+	case htmlRe.MatchString(s):
+		j := i
+		for j < len(lines) && !isBlank(lines[j].text) {
+			j++
+		}
+		c.warn(ln.num, "HTML block dropped")
+		return nil, j
+	case footnoteRe.MatchString(s):
+		j := i + 1
+		for j < len(lines) && (indentOf(lines[j].text) >= 4 || isBlank(lines[j].text) && j+1 < len(lines) && indentOf(lines[j+1].text) >= 4) {
+			j++
+		}
+		c.warn(ln.num, "footnote dropped")
+		return nil, j
+	case refRe.MatchString(s):
+		// collected beforehand
+		return nil, i + 1
+	case strings.Contains(s, "|") && i+1 < len(lines) && delimRowRe.MatchString(lines[i+1].text) &&
+		len(splitRow(s)) == len(splitRow(lines[i+1].text)):
+		return c.table(lines, i)
+	default:
+		return c.paragraph(lines, i)
+	}
+}
+
+func (c *converter) heading(level int, title string, num int) *ast.Heading {
+	text := c.inlines(title, num)
+	id := parser.Slug(text.Bare())
+	n := c.ids[id]
+	c.ids[id]++
+	if n > 0 {
+		id = fmt.Sprintf("%s-%d", id, n)
+	}
+	return &ast.Heading{Title: text, Level: level, ID: id}
+}
+
+func (c *converter) indentedCode(lines []line, i int) ([]ast.Node, int) {
+	var text []string
+	j := i
+	for ; j < len(lines); j++ {
+		s := lines[j].text
+		if isBlank(s) {
+			text = append(text, "")
+			continue
+		}
+		if indentOf(s) < 4 {
+			break
+		}
+		text = append(text, s[4:])
+	}
+	for len(text) > 0 && text[len(text)-1] == "" {
+		text = text[:len(text)-1]
+	}
+	return []ast.Node{&ast.Code{Text: "\n" + strings.Join(text, "\n") + "\n"}}, j
+}
+
+func (c *converter) fencedCode(lines []line, i int) ([]ast.Node, int) {
+	m := fenceRe.FindStringSubmatch(lines[i].text)
+	indent, fence := len(m[1]), m[2]
+	if info := strings.Fields(m[3]); len(info) > 0 {
+		c.warn(lines[i].num, "code block language %q dropped", info[0])
+	}
+	var text []string
+	j := i + 1
+	for ; j < len(lines); j++ {
+		s := lines[j].text
+		t := strings.TrimSpace(s)
+		if indentOf(s) < 4 && strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+			j++
+			break
+		}
+		n := indentOf(s)
+		if n > indent {
+			n = indent
+		}
+		text = append(text, s[n:])
+	}
+	return []ast.Node{&ast.Code{Text: "\n" + strings.Join(text, "\n") + "\n"}}, j
+}
+
+func (c *converter) math(lines []line, i int) ([]ast.Node, int) {
+	first := strings.TrimSpace(lines[i].text)[2:]
+	if t := strings.TrimSpace(first); strings.HasSuffix(t, "$$") && len(t) > 2 {
+		return []ast.Node{&ast.Math{TeX: strings.TrimSpace(t[:len(t)-2]), Display: true}}, i + 1
+	}
+	text := []string{}
+	if t := strings.TrimSpace(first); t != "" {
+		text = append(text, t)
+	}
+	j := i + 1
+	for ; j < len(lines); j++ {
+		t := strings.TrimSpace(lines[j].text)
+		if strings.HasSuffix(t, "$$") {
+			if t = strings.TrimSpace(t[:len(t)-2]); t != "" {
+				text = append(text, t)
+			}
+			j++
+			break
+		}
+		text = append(text, t)
+	}
+	return []ast.Node{&ast.Math{TeX: strings.Join(text, "\n"), Display: true}}, j
+}
+
+func (c *converter) quote(lines []line, i int) ([]ast.Node, int) {
+	var inner []line
+	j := i
+	for ; j < len(lines); j++ {
+		s := lines[j].text
+		if m := quoteRe.FindStringIndex(s); m != nil {
+			inner = append(inner, line{expandTabs(s[m[1]:]), lines[j].num})
+			continue
+		}
+		// lazy continuation of a paragraph
+		if len(inner) > 0 && !isBlank(inner[len(inner)-1].text) && !startsBlock(s) {
+			inner = append(inner, lines[j])
+			continue
+		}
+		break
+	}
+	if m := alertRe.FindStringSubmatch(strings.TrimSpace(inner[0].text)); m != nil {
+		callout := &ast.Callout{Kind: strings.ToLower(m[1])}
+		if title := strings.TrimSpace(m[2]); title != "" {
+			callout.Title = c.inlines(title, inner[0].num)
+		}
+		callout.Blocks = c.blocks(inner[1:])
+		return []ast.Node{callout}, j
+	}
+	return []ast.Node{&ast.BlockQuote{Blocks: c.blocks(inner)}}, j
+}
+
+// listMarker returns the marker of the list item starting s, the column
+// its content starts at and whether the list is ordered.
+func listMarker(s string) (marker string, content int, ordered, ok bool) {
+	var end int
+	if m := bulletRe.FindStringSubmatchIndex(s); m != nil {
+		marker, end = s[m[2]:m[3]], m[3]
+	} else if m := orderedRe.FindStringSubmatchIndex(s); m != nil {
+		marker, end, ordered = s[m[4]:m[5]], m[5], true
+	} else {
+		return "", 0, false, false
+	}
+	spaces := indentOf(s[end:])
+	if spaces == 0 || spaces > 4 || isBlank(s[end:]) {
+		spaces = 1
+	}
+	return marker, end + spaces, ordered, true
+}
+
+func isMarker(s string) bool {
+	_, _, _, ok := listMarker(s)
+	return ok
+}
+
+func (c *converter) list(lines []line, i int) ([]ast.Node, int) {
+	marker, _, ordered, _ := listMarker(lines[i].text)
+	if ordered {
+		if m := orderedRe.FindStringSubmatch(lines[i].text); m[1] != "1" {
+			c.warn(lines[i].num, "ordered list starting at %s renumbered from 1", m[1])
+		}
+	}
+	var items []*ast.ListItem
+	j := i
+	for j < len(lines) {
+		s := lines[j].text
+		if ruleRe.MatchString(s) {
+			break
+		}
+		m, content, o, ok := listMarker(s)
+		if !ok || m != marker || o != ordered {
+			break
+		}
+		first := ""
+		if content < len(s) {
+			first = s[content:]
+		}
+		if taskRe.MatchString(first) {
+			c.warn(lines[j].num, "task list checkbox kept as text")
+		}
+		inner := []line{{first, lines[j].num}}
+		for j++; j < len(lines); j++ {
+			s := lines[j].text
+			switch {
+			case isBlank(s):
+				inner = append(inner, line{"", lines[j].num})
+				continue
+			case indentOf(s) >= content:
+				inner = append(inner, line{s[content:], lines[j].num})
+				continue
+			case isMarker(s):
+			case !isBlank(inner[len(inner)-1].text) && !startsBlock(s) && !setextRe.MatchString(s):
+				// lazy continuation of a paragraph
+				inner = append(inner, lines[j])
+				continue
+			}
+			break
+		}
+		items = append(items, &ast.ListItem{Blocks: c.blocks(inner)})
+	}
+	if ordered {
+		return []ast.Node{&ast.OrderedList{Items: items}}, j
+	}
+	return []ast.Node{&ast.UnorderedList{Items: items}}, j
+}
+
+// splitRow returns the cells of a table row.
+func splitRow(s string) []string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "|")
+	if strings.HasSuffix(s, "|") && !strings.HasSuffix(s, `\|`) {
+		s = s[:len(s)-1]
+	}
+	var (
+		cells []string
+		cell  strings.Builder
+		code  bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case s[i] == '`':
+			code = !code
+			cell.WriteByte('`')
+		case s[i] == '|' && !code:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(s[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func (c *converter) table(lines []line, i int) ([]ast.Node, int) {
+	for _, d := range splitRow(lines[i+1].text) {
+		if strings.HasPrefix(d, ":") || strings.HasSuffix(d, ":") {
+			c.warn(lines[i+1].num, "table column alignment dropped")
+			break
+		}
+	}
+	cells := func(ln line) []ast.TextNode {
+		var out []ast.TextNode
+		for _, x := range splitRow(ln.text) {
+			out = append(out, c.inlines(x, ln.num))
+		}
+		return out
+	}
+	t := &ast.Table{Headers: cells(lines[i])}
+	j := i + 2
+	for ; j < len(lines) && !startsBlock(lines[j].text); j++ {
+		t.Rows = append(t.Rows, cells(lines[j]))
+	}
+	return []ast.Node{t}, j
+}
+
+func (c *converter) paragraph(lines []line, i int) ([]ast.Node, int) {
+	var text []string
+	j := i
+	for ; j < len(lines); j++ {
+		s := lines[j].text
+		if len(text) > 0 {
+			if m := setextRe.FindStringSubmatch(s); m != nil {
+				level := 1
+				if m[1][0] == '-' {
+					level = 2
+				}
+				return []ast.Node{c.heading(level, strings.Join(text, "\n"), lines[i].num)}, j + 1
+			}
+			if startsBlock(s) {
+				break
+			}
+		}
+		// keep the trailing spaces of hard line breaks
+		text = append(text, strings.TrimLeft(s, " "))
+	}
+	src := strings.TrimSpace(strings.Join(text, "\n"))
+	if img, ok := c.image(src); ok {
+		return []ast.Node{img}, j
+	}
+	return []ast.Node{c.inlines(src, lines[i].num)}, j
+}
+
+// image returns the image src consists of.
+func (c *converter) image(src string) (*ast.Image, bool) {
+	s := []rune(src)
+	if len(s) < 2 || s[0] != '!' || s[1] != '[' {
+		return nil, false
+	}
+	text, l, end, ok := c.link(s, 1)
+	if !ok || end != len(s) {
+		return nil, false
+	}
+	img := &ast.Image{Attrs: map[string]string{"src": l.dest}}
+	if alt := strings.TrimSpace(c.inlines(string(text), 0).Bare()); alt != "" {
+		img.Attrs["alt"] = alt
+	}
+	if l.title != "" {
+		img.Attrs["title"] = l.title
+	}
+	return img, true
+}
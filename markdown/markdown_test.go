@@ -0,0 +1,75 @@
+package markdown
+
+import (
+	"github.com/insomnimus/typeup/printer"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		md, want string
+	}{
+		{"# Title\n\nSetext\n======\n\nSub\n---\n", "# Title\n\n# Setext\n\n## Sub\n"},
+		{"*em* **strong** ***both*** `code` and \\*escaped\\*\n", "*em* _strong_ *_both_* `code` and *escaped*\n"},
+		{"see [link](https://example.com \"Home\") and <https://example.org>\n", "see [link][https://example.com] and [https://example.org]\n\n[https://example.com]: https://example.com \"Home\"\n"},
+		{"see [ref][r] and [R]\n\n[r]: https://example.com\n", "see [ref https://example.com] and [R https://example.com]\n"},
+		{"![alt](cat.png \"A cat\")\n", "![alt cat.png]\n"},
+		{"> quoted\nlazy\n", "| quoted\n| lazy\n"},
+		{"> [!NOTE]\n> Mind it.\n", ":::note\nMind it.\n:::\n"},
+		{"> [!WARNING] Careful\n> body\n", ":::warning Careful\nbody\n:::\n"},
+		{"- one\n- two\n  - nested\n", "[\n  one\n  (\ntwo\n\n[\n  nested\n]\n  )\n]\n"},
+		{"1. first\n2. second\n", "{\n  first\n  second\n}\n"},
+		{"```\ncode\n```\n", "```\ncode\n```\n"},
+		{"    indented\n", "```\nindented\n```\n"},
+		{"$$\nx^2\n$$\n", "$$ x^2 $$\n"},
+		{"inline $x$ math\n", "inline $x$ math\n"},
+		{"a | b\n--- | ---\n1 | 2\n", "#|{\na | b\n1 | 2\n}\n"},
+		{"***\n", "---\n"},
+		{"---\ntitle: Doc\nauthor: me\n---\n\ntext\n", "@{\nauthor = me\ntitle = Doc\n}\n\ntext\n"},
+	}
+	for _, tt := range tests {
+		nodes, meta, diags := Parse(tt.md)
+		if len(diags) > 0 {
+			t.Errorf("%q: unexpected diagnostics %v", tt.md, diags)
+		}
+		if got := printer.Print(nodes, meta); got != tt.want {
+			t.Errorf("%q\ngot:\n%s\nwant:\n%s", tt.md, got, tt.want)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		md    string
+		diags []string
+	}{
+		{"```go\nx\n```\n", []string{`line 1: code block language "go" dropped`}},
+		{"text\n\n<div>\nhi\n</div>\n", []string{"line 3: HTML block dropped"}},
+		{"text[^1]\n\n[^1]: note\n", []string{"line 1: footnote reference dropped", "line 3: footnote dropped"}},
+		{"a  \nb\n", []string{"line 1: hard line break dropped"}},
+		{"a\n![img](a.png) inline\n", []string{"line 2: inline image turned into a link"}},
+		{"a <b>bold</b>\n", []string{"line 1: inline HTML <b> dropped", "line 1: inline HTML </b> dropped"}},
+		{"~~gone~~\n", []string{"line 1: strikethrough dropped"}},
+		{"3. three\n4. four\n", []string{"line 1: ordered list starting at 3 renumbered from 1"}},
+		{"- [ ] task\n", []string{"line 1: task list checkbox kept as text"}},
+		{"a | b\n:-- | --:\n1 | 2\n", []string{"line 2: table column alignment dropped"}},
+		{"---\ntitle: x\nnot understood\n---\n", []string{"line 3: front matter line not understood, dropped"}},
+	}
+	for _, tt := range tests {
+		_, _, diags := Parse(tt.md)
+		var got []string
+		for _, d := range diags {
+			got = append(got, d.String())
+		}
+		if len(got) != len(tt.diags) {
+			t.Errorf("%q: got diagnostics %q, want %q", tt.md, got, tt.diags)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.diags[i] {
+				t.Errorf("%q: got diagnostics %q, want %q", tt.md, got, tt.diags)
+				break
+			}
+		}
+	}
+}
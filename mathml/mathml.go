@@ -0,0 +1,646 @@
+// Package mathml converts a subset of TeX math to MathML, so formulas can
+// be shown by browsers without any JavaScript.
+//
+// The subset covers letters, numbers and operators, sub and superscripts,
+// groups, \frac, \sqrt, \binom, \left and \right, accents, font commands,
+// \text, the common symbols and Greek letters, and the matrix, cases,
+// aligned and array environments.
+package mathml
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Convert returns tex as a MathML math element.
+// If display is set, the formula is laid out as a block.
+func Convert(tex string, display bool) (string, error) {
+	p := &parser{s: []rune(tex), display: display}
+	nodes, err := p.row(0)
+	if err != nil {
+		return "", err
+	}
+	if err := p.stray(); err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	out.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		out.WriteString(` display="block"`)
+	}
+	fmt.Fprintf(&out, `><semantics><mrow>%s</mrow><annotation encoding="application/x-tex">%s</annotation></semantics></math>`,
+		join(nodes), html.EscapeString(tex))
+	return out.String(), nil
+}
+
+type node struct {
+	xml    string
+	limits bool   // scripts go below and above, as with \sum in display math
+	style  string // set on the marker left by \displaystyle and \textstyle
+}
+
+type parser struct {
+	s       []rune
+	pos     int
+	display bool
+	variant string // mathvariant of identifiers, set by font commands
+}
+
+func (p *parser) peek() rune {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(p.s[p.pos]) {
+		p.pos++
+	}
+}
+
+// ahead reports whether the command name follows.
+func (p *parser) ahead(name string) bool {
+	end := p.pos + len(name) + 1
+	if end > len(p.s) || string(p.s[p.pos:end]) != `\`+name {
+		return false
+	}
+	return end == len(p.s) || !isLetter(p.s[end]) || !isLetter(p.s[end-1])
+}
+
+// stopped reports whether the parser is at a token that ends a row.
+func (p *parser) stopped(closing rune) bool {
+	switch ch := p.peek(); {
+	case ch == 0, ch == '}', ch == '&':
+		return true
+	case closing != 0 && ch == closing:
+		return true
+	}
+	return p.ahead(`\`) || p.ahead("right") || p.ahead("end")
+}
+
+// stray returns the error for the token that stopped a row where it should not.
+func (p *parser) stray() error {
+	switch {
+	case p.peek() == 0:
+		return nil
+	case p.peek() == '}':
+		return errors.New("unexpected '}'")
+	case p.peek() == '&':
+		return errors.New("'&' outside of an environment")
+	case p.ahead(`\`):
+		return errors.New(`'\\' outside of an environment`)
+	case p.ahead("right"):
+		return errors.New(`\right without \left`)
+	case p.ahead("end"):
+		return errors.New(`\end without \begin`)
+	default:
+		return fmt.Errorf("unexpected %q", p.peek())
+	}
+}
+
+// row parses atoms with their scripts until the end of the input,
+// closing or a token that ends a row.
+func (p *parser) row(closing rune) ([]node, error) {
+	var nodes []node
+	for {
+		p.skipSpace()
+		if p.stopped(closing) {
+			break
+		}
+		var (
+			base node
+			err  error
+		)
+		if ch := p.peek(); ch == '^' || ch == '_' {
+			base = node{xml: "<mrow></mrow>"}
+		} else if base, err = p.atom(false); err != nil {
+			return nil, err
+		}
+		if base.style != "" {
+			nodes = append(nodes, base)
+			continue
+		}
+		n, err := p.scripts(base)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+
+	// \displaystyle and \textstyle apply to the rest of the row
+	for i, n := range nodes {
+		if n.style != "" {
+			rest := join(nodes[i+1:])
+			nodes = append(nodes[:i], node{
+				xml: fmt.Sprintf(`<mstyle displaystyle=%q>%s</mstyle>`, n.style, rest),
+			})
+			break
+		}
+	}
+	return nodes, nil
+}
+
+func (p *parser) scripts(base node) (node, error) {
+	var (
+		sub    string
+		sup    []string
+		script bool // sup has a '^' script, not just primes
+	)
+	for {
+		p.skipSpace()
+		ch := p.peek()
+		if ch == '\'' {
+			primes := ""
+			for p.peek() == '\'' {
+				primes += "′"
+				p.pos++
+			}
+			sup = append(sup, "<mo>"+primes+"</mo>")
+			continue
+		}
+		if ch != '^' && ch != '_' {
+			break
+		}
+		p.pos++
+		arg, err := p.arg()
+		if err != nil {
+			return node{}, err
+		}
+		if ch == '^' {
+			if script {
+				return node{}, errors.New("double superscript")
+			}
+			script = true
+			sup = append(sup, arg)
+		} else {
+			if sub != "" {
+				return node{}, errors.New("double subscript")
+			}
+			sub = arg
+		}
+	}
+	over := strings.Join(sup, "")
+	if len(sup) > 1 {
+		over = "<mrow>" + over + "</mrow>"
+	}
+	under, above, both := "msub", "msup", "msubsup"
+	if base.limits {
+		under, above, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && over != "":
+		return node{xml: fmt.Sprintf("<%s>%s%s%s</%[1]s>", both, base.xml, sub, over)}, nil
+	case sub != "":
+		return node{xml: fmt.Sprintf("<%s>%s%s</%[1]s>", under, base.xml, sub)}, nil
+	case over != "":
+		return node{xml: fmt.Sprintf("<%s>%s%s</%[1]s>", above, base.xml, over)}, nil
+	default:
+		return base, nil
+	}
+}
+
+// arg parses the argument of a command or script: a group or a single token.
+func (p *parser) arg() (string, error) {
+	p.skipSpace()
+	if p.stopped(0) {
+		return "", errors.New("missing argument")
+	}
+	n, err := p.atom(true)
+	if err != nil {
+		return "", err
+	}
+	if n.style != "" {
+		return "", errors.New("missing argument")
+	}
+	return n.xml, nil
+}
+
+// group parses a braced group.
+func (p *parser) group() ([]node, error) {
+	p.skipSpace()
+	if p.peek() != '{' {
+		return nil, errors.New("missing '{'")
+	}
+	p.pos++
+	nodes, err := p.row(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != '}' {
+		if err := p.stray(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("missing '}'")
+	}
+	p.pos++
+	return nodes, nil
+}
+
+// text reads the raw text of a braced group.
+func (p *parser) text() (string, error) {
+	p.skipSpace()
+	if p.peek() != '{' {
+		return "", errors.New("missing '{'")
+	}
+	depth := 0
+	for i := p.pos; i < len(p.s); i++ {
+		switch p.s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				s := string(p.s[p.pos+1 : i])
+				p.pos = i + 1
+				return s, nil
+			}
+		}
+	}
+	return "", errors.New("missing '}'")
+}
+
+// atom parses a token, group or command. If single is set, a number is
+// read one digit at a time, as TeX does for arguments.
+func (p *parser) atom(single bool) (node, error) {
+	p.skipSpace()
+	ch := p.peek()
+	switch {
+	case ch == 0:
+		return node{}, errors.New("missing argument")
+	case ch == '{':
+		nodes, err := p.group()
+		if err != nil {
+			return node{}, err
+		}
+		return node{xml: "<mrow>" + join(nodes) + "</mrow>"}, nil
+	case ch == '\\':
+		return p.command()
+	case unicode.IsDigit(ch) || ch == '.' && p.pos+1 < len(p.s) && unicode.IsDigit(p.s[p.pos+1]):
+		start := p.pos
+		p.pos++
+		for !single && p.pos < len(p.s) {
+			if c := p.s[p.pos]; unicode.IsDigit(c) ||
+				c == '.' && p.pos+1 < len(p.s) && unicode.IsDigit(p.s[p.pos+1]) {
+				p.pos++
+				continue
+			}
+			break
+		}
+		return p.leaf("mn", string(p.s[start:p.pos])), nil
+	case unicode.IsLetter(ch):
+		p.pos++
+		return p.leaf("mi", string(ch)), nil
+	case ch == '~':
+		p.pos++
+		return node{xml: "<mtext> </mtext>"}, nil
+	case ch == '\'':
+		p.pos++
+		return node{xml: "<mo>′</mo>"}, nil
+	case ch == '-':
+		p.pos++
+		return node{xml: "<mo>−</mo>"}, nil
+	case strings.ContainsRune("()[]|", ch):
+		p.pos++
+		return node{xml: fmt.Sprintf(`<mo stretchy="false">%s</mo>`, html.EscapeString(string(ch)))}, nil
+	default:
+		p.pos++
+		return node{xml: "<mo>" + html.EscapeString(string(ch)) + "</mo>"}, nil
+	}
+}
+
+func (p *parser) leaf(tag, text string) node {
+	if p.variant != "" {
+		return node{xml: fmt.Sprintf("<%s mathvariant=%q>%s</%[1]s>", tag, p.variant, html.EscapeString(text))}
+	}
+	return node{xml: fmt.Sprintf("<%s>%s</%[1]s>", tag, html.EscapeString(text))}
+}
+
+func (p *parser) command() (node, error) {
+	p.pos++ // the backslash
+	start := p.pos
+	if isLetter(p.peek()) {
+		for isLetter(p.peek()) {
+			p.pos++
+		}
+	} else if p.peek() != 0 {
+		p.pos++
+	}
+	name := string(p.s[start:p.pos])
+
+	if s, ok := identifiers[name]; ok {
+		if unicode.IsUpper([]rune(s)[0]) && p.variant == "" {
+			return node{xml: `<mi mathvariant="normal">` + s + "</mi>"}, nil
+		}
+		return p.leaf("mi", s), nil
+	}
+	if s, ok := operators[name]; ok {
+		return node{xml: "<mo>" + html.EscapeString(s) + "</mo>"}, nil
+	}
+	if s, ok := bigOperators[name]; ok {
+		return node{xml: `<mo largeop="true" movablelimits="true">` + s + "</mo>", limits: p.display && !strings.HasSuffix(name, "int")}, nil
+	}
+	if _, ok := functions[name]; ok {
+		return node{xml: "<mi>" + name + "</mi>", limits: p.display && functions[name]}, nil
+	}
+	if w, ok := spaces[name]; ok {
+		return node{xml: fmt.Sprintf(`<mspace width=%q></mspace>`, w)}, nil
+	}
+	if v, ok := variants[name]; ok {
+		old := p.variant
+		p.variant = v
+		arg, err := p.arg()
+		p.variant = old
+		return node{xml: arg}, err
+	}
+	if a, ok := accents[name]; ok {
+		arg, err := p.arg()
+		if err != nil {
+			return node{}, err
+		}
+		if a.under {
+			return node{xml: fmt.Sprintf(`<munder accentunder="true">%s<mo stretchy=%q>%s</mo></munder>`, arg, a.stretchy, a.mark)}, nil
+		}
+		return node{xml: fmt.Sprintf(`<mover accent="true">%s<mo stretchy=%q>%s</mo></mover>`, arg, a.stretchy, a.mark)}, nil
+	}
+	if size, ok := sizes[name]; ok {
+		d, err := p.delim()
+		if err != nil {
+			return node{}, err
+		}
+		return node{xml: fmt.Sprintf(`<mo minsize=%q maxsize=%[1]q>%s</mo>`, size, d)}, nil
+	}
+
+	switch name {
+	case "":
+		return node{}, errors.New(`lone '\' at the end`)
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, err := p.arg()
+		if err != nil {
+			return node{}, err
+		}
+		den, err := p.arg()
+		if err != nil {
+			return node{}, err
+		}
+		frac := "<mfrac>" + num + den + "</mfrac>"
+		switch name {
+		case "dfrac", "cfrac":
+			frac = `<mstyle displaystyle="true">` + frac + "</mstyle>"
+		case "tfrac":
+			frac = `<mstyle displaystyle="false">` + frac + "</mstyle>"
+		}
+		return node{xml: frac}, nil
+	case "binom":
+		n, err := p.arg()
+		if err != nil {
+			return node{}, err
+		}
+		k, err := p.arg()
+		if err != nil {
+			return node{}, err
+		}
+		return node{xml: `<mrow><mo>(</mo><mfrac linethickness="0">` + n + k + "</mfrac><mo>)</mo></mrow>"}, nil
+	case "sqrt":
+		p.skipSpace()
+		var index []node
+		if p.peek() == '[' {
+			p.pos++
+			var err error
+			if index, err = p.row(']'); err != nil {
+				return node{}, err
+			}
+			if p.peek() != ']' {
+				return node{}, errors.New("missing ']'")
+			}
+			p.pos++
+		}
+		arg, err := p.arg()
+		if err != nil {
+			return node{}, err
+		}
+		if index != nil {
+			return node{xml: "<mroot>" + arg + "<mrow>" + join(index) + "</mrow></mroot>"}, nil
+		}
+		return node{xml: "<msqrt>" + arg + "</msqrt>"}, nil
+	case "left":
+		open, err := p.delim()
+		if err != nil {
+			return node{}, err
+		}
+		body, err := p.row(0)
+		if err != nil {
+			return node{}, err
+		}
+		if !p.ahead("right") {
+			if err := p.stray(); err != nil {
+				return node{}, err
+			}
+			return node{}, errors.New(`\left without \right`)
+		}
+		p.pos += len(`\right`)
+		closing, err := p.delim()
+		if err != nil {
+			return node{}, err
+		}
+		return node{xml: "<mrow>" + fence(open) + join(body) + fence(closing) + "</mrow>"}, nil
+	case "text", "textrm", "textnormal", "mbox", "textbf", "textit", "texttt":
+		s, err := p.text()
+		if err != nil {
+			return node{}, err
+		}
+		variant := map[string]string{"textbf": "bold", "textit": "italic", "texttt": "monospace"}[name]
+		if variant != "" {
+			return node{xml: fmt.Sprintf("<mtext mathvariant=%q>%s</mtext>", variant, html.EscapeString(s))}, nil
+		}
+		return node{xml: "<mtext>" + html.EscapeString(s) + "</mtext>"}, nil
+	case "operatorname":
+		s, err := p.text()
+		if err != nil {
+			return node{}, err
+		}
+		return node{xml: `<mi mathvariant="normal">` + html.EscapeString(strings.TrimSpace(s)) + "</mi>"}, nil
+	case "pmod":
+		arg, err := p.arg()
+		if err != nil {
+			return node{}, err
+		}
+		return node{xml: `<mrow><mspace width="0.444em"></mspace><mo>(</mo><mi>mod</mi><mspace width="0.333em"></mspace>` + arg + "<mo>)</mo></mrow>"}, nil
+	case "not":
+		p.skipSpace()
+		if p.stopped(0) {
+			return node{}, errors.New("missing argument")
+		}
+		n, err := p.atom(true)
+		if err != nil {
+			return node{}, err
+		}
+		if i := strings.Index(n.xml, "</mo>"); strings.HasPrefix(n.xml, "<mo") && i > 0 {
+			return node{xml: n.xml[:i] + "̸" + n.xml[i:]}, nil
+		}
+		return node{}, errors.New(`\not must be followed by an operator`)
+	case "displaystyle":
+		return node{style: "true"}, nil
+	case "textstyle":
+		return node{style: "false"}, nil
+	case "begin":
+		return p.env()
+	case "right":
+		return node{}, errors.New(`\right without \left`)
+	case "end":
+		return node{}, errors.New(`\end without \begin`)
+	}
+	return node{}, fmt.Errorf(`unknown command \%s`, name)
+}
+
+// delim reads the delimiter after \left, \right or \big.
+func (p *parser) delim() (string, error) {
+	p.skipSpace()
+	ch := p.peek()
+	switch {
+	case ch == '\\':
+		p.pos++
+		start := p.pos
+		for isLetter(p.peek()) {
+			p.pos++
+		}
+		if p.pos == start && p.peek() != 0 {
+			p.pos++
+		}
+		name := string(p.s[start:p.pos])
+		if d, ok := delimiters[name]; ok {
+			return d, nil
+		}
+		return "", fmt.Errorf(`\%s is not a delimiter`, name)
+	case strings.ContainsRune("()[]|/.<>", ch):
+		p.pos++
+		switch ch {
+		case '.':
+			return "", nil
+		case '<':
+			return "⟨", nil
+		case '>':
+			return "⟩", nil
+		}
+		return string(ch), nil
+	case ch == 0:
+		return "", errors.New("missing delimiter")
+	default:
+		return "", fmt.Errorf("%q is not a delimiter", ch)
+	}
+}
+
+func fence(d string) string {
+	if d == "" {
+		return ""
+	}
+	return `<mo fence="true" stretchy="true">` + html.EscapeString(d) + "</mo>"
+}
+
+func (p *parser) env() (node, error) {
+	name, err := p.text()
+	if err != nil {
+		return node{}, err
+	}
+	e, ok := environments[name]
+	if !ok {
+		return node{}, fmt.Errorf("unknown environment %q", name)
+	}
+	align := e.align
+	if name == "array" {
+		spec, err := p.text()
+		if err != nil {
+			return node{}, err
+		}
+		var cols []string
+		for _, c := range spec {
+			switch c {
+			case 'l':
+				cols = append(cols, "left")
+			case 'c':
+				cols = append(cols, "center")
+			case 'r':
+				cols = append(cols, "right")
+			}
+		}
+		align = strings.Join(cols, " ")
+	}
+
+	var (
+		rows  [][]string
+		cells []string
+	)
+	for {
+		nodes, err := p.row(0)
+		if err != nil {
+			return node{}, err
+		}
+		cells = append(cells, join(nodes))
+		switch {
+		case p.peek() == '&':
+			p.pos++
+			continue
+		case p.ahead(`\`):
+			p.pos += 2
+			rows = append(rows, cells)
+			cells = nil
+			continue
+		case p.ahead("end"):
+			p.pos += len(`\end`)
+			end, err := p.text()
+			if err != nil {
+				return node{}, err
+			}
+			if end != name {
+				return node{}, fmt.Errorf(`\begin{%s} ended by \end{%s}`, name, end)
+			}
+		default:
+			if err := p.stray(); err != nil {
+				return node{}, err
+			}
+			return node{}, fmt.Errorf(`\begin{%s} without \end`, name)
+		}
+		break
+	}
+	// a trailing \\ does not start a row
+	if len(cells) > 1 || cells[0] != "" {
+		rows = append(rows, cells)
+	}
+
+	var out strings.Builder
+	out.WriteString("<mtable")
+	if align != "" {
+		fmt.Fprintf(&out, " columnalign=%q", align)
+	}
+	if e.display {
+		out.WriteString(` displaystyle="true"`)
+	}
+	out.WriteString(">")
+	for _, r := range rows {
+		out.WriteString("<mtr>")
+		for _, c := range r {
+			out.WriteString("<mtd>" + c + "</mtd>")
+		}
+		out.WriteString("</mtr>")
+	}
+	out.WriteString("</mtable>")
+	if e.open == "" && e.close == "" {
+		return node{xml: out.String()}, nil
+	}
+	return node{xml: "<mrow>" + fence(e.open) + out.String() + fence(e.close) + "</mrow>"}, nil
+}
+
+func join(nodes []node) string {
+	var out strings.Builder
+	for _, n := range nodes {
+		out.WriteString(n.xml)
+	}
+	return out.String()
+}
+
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
@@ -0,0 +1,208 @@
+package mathml
+
+import (
+	"html"
+	"strings"
+	"testing"
+)
+
+// body returns the MathML of tex without the math element around it.
+func body(t *testing.T, tex string, display bool) string {
+	t.Helper()
+	s, err := Convert(tex, display)
+	if err != nil {
+		t.Fatalf("%s: %v", tex, err)
+	}
+	start := strings.Index(s, "<semantics><mrow>") + len("<semantics><mrow>")
+	end := strings.LastIndex(s, "</mrow><annotation")
+	if start < len("<semantics><mrow>") || end < start {
+		t.Fatalf("%s: malformed output %s", tex, s)
+	}
+	return s[start:end]
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		tex     string
+		display bool
+		want    string
+	}{
+		// tokens
+		{`x`, false, `<mi>x</mi>`},
+		{`12`, false, `<mn>12</mn>`},
+		{`3.14`, false, `<mn>3.14</mn>`},
+		{`-x`, false, `<mo>−</mo><mi>x</mi>`},
+		{`a~b`, false, "<mi>a</mi><mtext>\u00a0</mtext><mi>b</mi>"},
+		{`[a]`, false, `<mo stretchy="false">[</mo><mi>a</mi><mo stretchy="false">]</mo>`},
+		{`a+b`, false, `<mi>a</mi><mo>+</mo><mi>b</mi>`},
+		{`\{x\}`, false, `<mo>{</mo><mi>x</mi><mo>}</mo>`},
+
+		// scripts
+		{`x^2`, false, `<msup><mi>x</mi><mn>2</mn></msup>`},
+		{`x^23`, false, `<msup><mi>x</mi><mn>2</mn></msup><mn>3</mn>`},
+		{`a_i^2`, false, `<msubsup><mi>a</mi><mi>i</mi><mn>2</mn></msubsup>`},
+		{`x'`, false, `<msup><mi>x</mi><mo>′</mo></msup>`},
+		{`f''`, false, `<msup><mi>f</mi><mo>′′</mo></msup>`},
+		{`x'^2`, false, `<msup><mi>x</mi><mrow><mo>′</mo><mn>2</mn></mrow></msup>`},
+		{`^2`, false, `<msup><mrow></mrow><mn>2</mn></msup>`},
+
+		// limits in display math only, and never on integrals
+		{`\sum_i^n`, false, `<msubsup><mo largeop="true" movablelimits="true">∑</mo><mi>i</mi><mi>n</mi></msubsup>`},
+		{`\sum_i^n`, true, `<munderover><mo largeop="true" movablelimits="true">∑</mo><mi>i</mi><mi>n</mi></munderover>`},
+		{`\int_0^1`, true, `<msubsup><mo largeop="true" movablelimits="true">∫</mo><mn>0</mn><mn>1</mn></msubsup>`},
+		{`\lim_{x\to 0}`, true, `<munder><mi>lim</mi><mrow><mi>x</mi><mo>→</mo><mn>0</mn></mrow></munder>`},
+		{`\sin_x`, true, `<msub><mi>sin</mi><mi>x</mi></msub>`},
+
+		// commands
+		{`\frac{a}{b}`, false, `<mfrac><mrow><mi>a</mi></mrow><mrow><mi>b</mi></mrow></mfrac>`},
+		{`\frac12`, false, `<mfrac><mn>1</mn><mn>2</mn></mfrac>`},
+		{`\dfrac12`, false, `<mstyle displaystyle="true"><mfrac><mn>1</mn><mn>2</mn></mfrac></mstyle>`},
+		{`\cfrac12`, false, `<mstyle displaystyle="true"><mfrac><mn>1</mn><mn>2</mn></mfrac></mstyle>`},
+		{`\tfrac12`, false, `<mstyle displaystyle="false"><mfrac><mn>1</mn><mn>2</mn></mfrac></mstyle>`},
+		{`\binom nk`, false, `<mrow><mo>(</mo><mfrac linethickness="0"><mi>n</mi><mi>k</mi></mfrac><mo>)</mo></mrow>`},
+		{`\sqrt{x}`, false, `<msqrt><mrow><mi>x</mi></mrow></msqrt>`},
+		{`\sqrt[3]{x}`, false, `<mroot><mrow><mi>x</mi></mrow><mrow><mn>3</mn></mrow></mroot>`},
+		{`\left( x \right)`, false, `<mrow><mo fence="true" stretchy="true">(</mo><mi>x</mi><mo fence="true" stretchy="true">)</mo></mrow>`},
+		{`\left. x \right|`, false, `<mrow><mi>x</mi><mo fence="true" stretchy="true">|</mo></mrow>`},
+		{`\left< x \right>`, false, `<mrow><mo fence="true" stretchy="true">⟨</mo><mi>x</mi><mo fence="true" stretchy="true">⟩</mo></mrow>`},
+		{`\left\langle x \right\rangle`, false, `<mrow><mo fence="true" stretchy="true">⟨</mo><mi>x</mi><mo fence="true" stretchy="true">⟩</mo></mrow>`},
+		{`\big(`, false, `<mo minsize="1.2em" maxsize="1.2em">(</mo>`},
+		{`\Bigg\}`, false, `<mo minsize="3em" maxsize="3em">}</mo>`},
+		{`\hat x`, false, `<mover accent="true"><mi>x</mi><mo stretchy="false">^</mo></mover>`},
+		{`\underbrace{x}`, false, `<munder accentunder="true"><mrow><mi>x</mi></mrow><mo stretchy="true">⏟</mo></munder>`},
+		{`\mathbf{x}`, false, `<mrow><mi mathvariant="bold">x</mi></mrow>`},
+		{`\mathbb R`, false, `<mi mathvariant="double-struck">R</mi>`},
+		{`\mathbf\Gamma`, false, `<mi mathvariant="bold">Γ</mi>`},
+		{`\alpha\Gamma`, false, `<mi>α</mi><mi mathvariant="normal">Γ</mi>`},
+		{`\text{if } x`, false, `<mtext>if </mtext><mi>x</mi>`},
+		{`\textbf{b}\textit{i}\texttt{t}`, false, `<mtext mathvariant="bold">b</mtext><mtext mathvariant="italic">i</mtext><mtext mathvariant="monospace">t</mtext>`},
+		{`\mbox{a {b}}`, false, `<mtext>a {b}</mtext>`},
+		{`\operatorname{ sgn }`, false, `<mi mathvariant="normal">sgn</mi>`},
+		{`\pmod p`, false, `<mrow><mspace width="0.444em"></mspace><mo>(</mo><mi>mod</mi><mspace width="0.333em"></mspace><mi>p</mi><mo>)</mo></mrow>`},
+		{`\not=`, false, "<mo>≠</mo>"},
+		{`\not\in`, false, "<mo>∉</mo>"},
+		{`a\,b\quad c`, false, `<mi>a</mi><mspace width="0.1667em"></mspace><mi>b</mi><mspace width="1em"></mspace><mi>c</mi>`},
+		{`a \bmod b`, false, `<mi>a</mi><mo>mod</mo><mi>b</mi>`},
+		{`a\displaystyle b`, false, `<mi>a</mi><mstyle displaystyle="true"><mi>b</mi></mstyle>`},
+		{`\textstyle b`, true, `<mstyle displaystyle="false"><mi>b</mi></mstyle>`},
+
+		// environments
+		{`\begin{matrix}a&b\\c&d\end{matrix}`, false, `<mtable><mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr><mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr></mtable>`},
+		{`\begin{pmatrix}a\end{pmatrix}`, false, `<mrow><mo fence="true" stretchy="true">(</mo><mtable><mtr><mtd><mi>a</mi></mtd></mtr></mtable><mo fence="true" stretchy="true">)</mo></mrow>`},
+		{`\begin{Vmatrix}a\end{Vmatrix}`, false, `<mrow><mo fence="true" stretchy="true">‖</mo><mtable><mtr><mtd><mi>a</mi></mtd></mtr></mtable><mo fence="true" stretchy="true">‖</mo></mrow>`},
+		{`\begin{cases}1&x\\0&y\\\end{cases}`, false, `<mrow><mo fence="true" stretchy="true">{</mo><mtable columnalign="left left"><mtr><mtd><mn>1</mn></mtd><mtd><mi>x</mi></mtd></mtr><mtr><mtd><mn>0</mn></mtd><mtd><mi>y</mi></mtd></mtr></mtable></mrow>`},
+		{`\begin{array}{l|cr}a&b&c\end{array}`, false, `<mtable columnalign="left center right"><mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd><mtd><mi>c</mi></mtd></mtr></mtable>`},
+		{`\begin{aligned}a&=b\end{aligned}`, false, `<mtable columnalign="right left" displaystyle="true"><mtr><mtd><mi>a</mi></mtd><mtd><mo>=</mo><mi>b</mi></mtd></mtr></mtable>`},
+		{`\begin{gathered}a\end{gathered}`, false, `<mtable displaystyle="true"><mtr><mtd><mi>a</mi></mtd></mtr></mtable>`},
+
+		// escaping
+		{`a<b`, false, `<mi>a</mi><mo>&lt;</mo><mi>b</mi>`},
+		{`\text{<&>"}`, false, `<mtext>&lt;&amp;&gt;&#34;</mtext>`},
+		{`\operatorname{a&b}`, false, `<mi mathvariant="normal">a&amp;b</mi>`},
+		{`\&`, false, `<mo>&amp;</mo>`},
+	}
+	for _, tt := range tests {
+		if got := body(t, tt.tex, tt.display); got != tt.want {
+			t.Errorf("%s\ngot  %s\nwant %s", tt.tex, got, tt.want)
+		}
+	}
+}
+
+func TestConvertElement(t *testing.T) {
+	s, err := Convert(`a<b`, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block"><semantics><mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow><annotation encoding="application/x-tex">a&lt;b</annotation></semantics></math>`
+	if s != want {
+		t.Errorf("got  %s\nwant %s", s, want)
+	}
+	if s, _ := Convert("x", false); strings.Contains(s, "display=") {
+		t.Errorf("inline math laid out as a block: %s", s)
+	}
+}
+
+// TestSymbols converts every command of the tables in symbols.go.
+func TestSymbols(t *testing.T) {
+	check := func(tex, want string) {
+		t.Helper()
+		if got := body(t, tex, true); !strings.Contains(got, want) {
+			t.Errorf("%s: %s does not contain %s", tex, got, want)
+		}
+	}
+	for name, s := range identifiers {
+		check(`\`+name, ">"+html.EscapeString(s)+"</mi>")
+	}
+	for name, s := range operators {
+		check(`\`+name, "<mo>"+html.EscapeString(s)+"</mo>")
+	}
+	for name, s := range bigOperators {
+		check(`\`+name+`_a^b`, ">"+s+"</mo>")
+	}
+	for name := range functions {
+		check(`\`+name, "<mi>"+name+"</mi>")
+	}
+	for name, w := range spaces {
+		check(`a\`+name+` b`, `<mspace width="`+w+`">`)
+	}
+	for name, v := range variants {
+		check(`\`+name+`{x}`, `mathvariant="`+v+`"`)
+	}
+	for name, a := range accents {
+		check(`\`+name+`{x}`, ">"+a.mark+"</mo>")
+	}
+	for name, size := range sizes {
+		check(`\`+name+`|`, `minsize="`+size+`"`)
+	}
+	for name, d := range delimiters {
+		check(`\left\`+name+` x \right.`, ">"+html.EscapeString(d)+"</mo>")
+	}
+	for name := range environments {
+		tex := `\begin{` + name + `}a&b\\c&d\end{` + name + `}`
+		if name == "array" {
+			tex = `\begin{array}{cc}a&b\\c&d\end{array}`
+		}
+		check(tex, "<mtd><mi>d</mi></mtd></mtr></mtable>")
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		tex, err string
+	}{
+		{`}`, "unexpected '}'"},
+		{`{a`, "missing '}'"},
+		{`a&b`, "'&' outside of an environment"},
+		{`a\\b`, `'\\' outside of an environment`},
+		{`a\right)`, `\right without \left`},
+		{`\left( a`, `\left without \right`},
+		{`\left\alpha a\right)`, `\alpha is not a delimiter`},
+		{`\left x\right)`, `'x' is not a delimiter`},
+		{`\left`, "missing delimiter"},
+		{`\end{matrix}`, `\end without \begin`},
+		{`\begin{foo}a\end{foo}`, `unknown environment "foo"`},
+		{`\begin{matrix}a\end{pmatrix}`, `\begin{matrix} ended by \end{pmatrix}`},
+		{`\begin{matrix}a`, `\begin{matrix} without \end`},
+		{`\begin{matrix}a}`, "unexpected '}'"},
+		{`\foo`, `unknown command \foo`},
+		{`a\`, `lone '\' at the end`},
+		{`x^2^3`, "double superscript"},
+		{`x_2_3`, "double subscript"},
+		{`x^`, "missing argument"},
+		{`\frac{a}`, "missing argument"},
+		{`\frac a\displaystyle`, "missing argument"},
+		{`\sqrt[3{x}`, "missing ']'"},
+		{`\text x`, "missing '{'"},
+		{`\text{x`, "missing '}'"},
+		{`\not a`, `\not must be followed by an operator`},
+		{`\not`, "missing argument"},
+	}
+	for _, tt := range tests {
+		_, err := Convert(tt.tex, false)
+		if err == nil {
+			t.Errorf("%s: no error, want %q", tt.tex, tt.err)
+		} else if err.Error() != tt.err {
+			t.Errorf("%s: got error %q, want %q", tt.tex, err, tt.err)
+		}
+	}
+}
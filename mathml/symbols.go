@@ -0,0 +1,136 @@
+package mathml
+
+// identifiers are the commands for letters and ordinary symbols.
+var identifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ",
+	"varepsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ",
+	"pi": "π", "varpi": "ϖ", "rho": "ρ", "varrho": "ϱ", "sigma": "σ",
+	"varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ", "varphi": "φ",
+	"chi": "χ", "psi": "ψ", "omega": "ω",
+
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ",
+	"Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ",
+	"Omega": "Ω",
+
+	"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅",
+	"varnothing": "∅", "hbar": "ℏ", "ell": "ℓ", "aleph": "ℵ", "Re": "ℜ",
+	"Im": "ℑ", "wp": "℘", "angle": "∠", "triangle": "△", "top": "⊤",
+	"bot": "⊥", "%": "%", "$": "$", "#": "#", "_": "_",
+}
+
+// operators are the commands for operators, relations, arrows and
+// delimiters.
+var operators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗",
+	"star": "⋆", "circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖",
+	"otimes": "⊗", "odot": "⊙", "setminus": "∖", "wedge": "∧", "land": "∧",
+	"vee": "∨", "lor": "∨", "neg": "¬", "lnot": "¬", "cup": "∪", "cap": "∩",
+
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠",
+	"approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅",
+	"propto": "∝", "ll": "≪", "gg": "≫", "in": "∈", "notin": "∉", "ni": "∋",
+	"subset": "⊂", "supset": "⊃", "subseteq": "⊆", "supseteq": "⊇",
+	"mid": "∣", "parallel": "∥", "perp": "⊥", "models": "⊨", "vdash": "⊢",
+	"forall": "∀", "exists": "∃", "nexists": "∄",
+
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"leftrightarrow": "↔", "Rightarrow": "⇒", "Leftarrow": "⇐",
+	"Leftrightarrow": "⇔", "implies": "⟹", "impliedby": "⟸", "iff": "⟺",
+	"mapsto": "↦", "longrightarrow": "⟶", "longleftarrow": "⟵",
+	"uparrow": "↑", "downarrow": "↓", "Uparrow": "⇑", "Downarrow": "⇓",
+
+	"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+	"colon": ":", "langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋",
+	"lceil": "⌈", "rceil": "⌉", "{": "{", "}": "}", "|": "‖", "&": "&",
+	"bmod": "mod",
+}
+
+// bigOperators take their scripts as limits in display math,
+// except for the integrals.
+var bigOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬",
+	"iiint": "∭", "oint": "∮", "bigcup": "⋃", "bigcap": "⋂",
+	"bigoplus": "⨁", "bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀",
+}
+
+// functions are the named functions; those set to true take their
+// scripts as limits in display math.
+var functions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false,
+	"csc": false, "arcsin": false, "arccos": false, "arctan": false,
+	"sinh": false, "cosh": false, "tanh": false, "coth": false, "log": false,
+	"ln": false, "lg": false, "exp": false, "deg": false, "dim": false,
+	"ker": false, "arg": false, "hom": false,
+	"lim": true, "limsup": true, "liminf": true, "max": true, "min": true,
+	"sup": true, "inf": true, "det": true, "gcd": true, "Pr": true,
+}
+
+var spaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em",
+	"!": "-0.1667em", " ": "0.25em", "quad": "1em", "qquad": "2em",
+}
+
+// variants are the font commands, by mathvariant.
+var variants = map[string]string{
+	"mathbf": "bold", "mathit": "italic", "mathrm": "normal",
+	"mathsf": "sans-serif", "mathtt": "monospace", "mathbb": "double-struck",
+	"mathcal": "script", "mathscr": "script", "mathfrak": "fraktur",
+	"boldsymbol": "bold-italic",
+}
+
+type accent struct {
+	mark     string
+	stretchy string
+	under    bool
+}
+
+var accents = map[string]accent{
+	"hat": {"^", "false", false}, "widehat": {"^", "true", false},
+	"bar": {"¯", "false", false}, "overline": {"‾", "true", false},
+	"vec": {"→", "false", false}, "overrightarrow": {"→", "true", false},
+	"dot": {"˙", "false", false}, "ddot": {"¨", "false", false},
+	"tilde": {"~", "false", false}, "widetilde": {"~", "true", false},
+	"acute": {"´", "false", false}, "grave": {"`", "false", false},
+	"breve": {"˘", "false", false}, "check": {"ˇ", "false", false},
+	"overbrace": {"⏞", "true", false}, "underbrace": {"⏟", "true", true},
+	"underline": {"_", "true", true},
+}
+
+// sizes are the commands for delimiters of a fixed size.
+var sizes = map[string]string{
+	"big": "1.2em", "bigl": "1.2em", "bigr": "1.2em", "bigm": "1.2em",
+	"Big": "1.8em", "Bigl": "1.8em", "Bigr": "1.8em", "Bigm": "1.8em",
+	"bigg": "2.4em", "biggl": "2.4em", "biggr": "2.4em", "biggm": "2.4em",
+	"Bigg": "3em", "Biggl": "3em", "Biggr": "3em", "Biggm": "3em",
+}
+
+// delimiters are the commands allowed after \left, \right and \big.
+var delimiters = map[string]string{
+	"{": "{", "}": "}", "|": "‖", "langle": "⟨", "rangle": "⟩",
+	"lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"vert": "|", "Vert": "‖", "lvert": "|", "rvert": "|", "lVert": "‖",
+	"rVert": "‖", "uparrow": "↑", "downarrow": "↓", "backslash": "\\",
+}
+
+type environment struct {
+	open, close string
+	align       string
+	display     bool
+}
+
+var environments = map[string]environment{
+	"matrix":   {},
+	"array":    {},
+	"pmatrix":  {open: "(", close: ")"},
+	"bmatrix":  {open: "[", close: "]"},
+	"Bmatrix":  {open: "{", close: "}"},
+	"vmatrix":  {open: "|", close: "|"},
+	"Vmatrix":  {open: "‖", close: "‖"},
+	"cases":    {open: "{", align: "left left"},
+	"aligned":  {align: "right left", display: true},
+	"align":    {align: "right left", display: true},
+	"align*":   {align: "right left", display: true},
+	"gathered": {display: true},
+	"split":    {align: "right left", display: true},
+}
@@ -0,0 +1,347 @@
+// Package pandoc converts typeup documents to and from the JSON
+// representation of pandoc's AST, as read and written by
+// "pandoc -f json" and "pandoc -t json" and passed to pandoc filters.
+//
+// The mapping follows what pandoc's own readers produce where it can:
+//
+//	TextBlock      Para, or Plain inside lists and table cells
+//	Heading        Header; the document title is left to the title meta data
+//	UnorderedList  BulletList
+//	OrderedList    OrderedList, decimal with a period
+//	Table          Table with one head row and one body
+//	Code           CodeBlock, or Code inline
+//	Image          Image alone in a Para, other attributes as key-value pairs
+//	Video          Image of class "video", which pandoc's HTML writer
+//	               renders as a <video>
+//	BlockQuote     BlockQuote, ending in a Div of class "attribution"
+//	Callout        Div of classes "callout" and the kind, led by a Div of
+//	               class "title" like pandoc's GitHub alerts
+//	Math           Math, in a Para of its own when displayed
+//	ThemeBreak     HorizontalRule
+//	Anchor         Link
+//
+// Pandoc constructs typeup has no equivalent for are reduced to their
+// contents; footnotes and raw blocks are dropped.
+package pandoc
+
+import (
+	"encoding/json"
+	"github.com/insomnimus/typeup/ast"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// APIVersion is the version of pandoc-types written by Marshal.
+var APIVersion = []int{1, 23, 1}
+
+// el is a pandoc element as written by Marshal.
+type el struct {
+	T string      `json:"t"`
+	C interface{} `json:"c,omitempty"`
+}
+
+func list(xs ...interface{}) []interface{} {
+	if xs == nil {
+		return []interface{}{}
+	}
+	return xs
+}
+
+// attr returns a pandoc Attr.
+func attr(id string, classes []string, kv map[string]string) []interface{} {
+	pairs := list()
+	var keys []string
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		pairs = append(pairs, list(k, kv[k]))
+	}
+	cls := list()
+	for _, c := range classes {
+		cls = append(cls, c)
+	}
+	return list(id, cls, pairs)
+}
+
+var noAttr = attr("", nil, nil)
+
+// numbered returns kv with the number given by a numbering pass, if any.
+func numbered(number string, kv map[string]string) map[string]string {
+	if number == "" {
+		return kv
+	}
+	if kv == nil {
+		kv = make(map[string]string)
+	}
+	kv["number"] = number
+	return kv
+}
+
+// Fprint writes nodes and meta to w as pandoc JSON.
+func Fprint(w io.Writer, nodes []ast.Node, meta map[string]string) error {
+	data, err := Marshal(nodes, meta)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Marshal returns nodes and meta as pandoc JSON.
+func Marshal(nodes []ast.Node, meta map[string]string) ([]byte, error) {
+	m := make(map[string]interface{})
+	for k, v := range meta {
+		m[k] = el{"MetaString", v}
+	}
+	blocks := list()
+	for _, n := range nodes {
+		// pandoc writers make the title out of the meta data
+		if h, ok := n.(*ast.Heading); ok && h.IsTitle && meta["title"] != "" {
+			continue
+		}
+		if b := block(n, false); b != nil {
+			blocks = append(blocks, b)
+		}
+	}
+	return json.Marshal(map[string]interface{}{
+		"pandoc-api-version": APIVersion,
+		"meta":               m,
+		"blocks":             blocks,
+	})
+}
+
+func blocks(nodes []ast.Node, tight bool) []interface{} {
+	out := list()
+	for _, n := range nodes {
+		if b := block(n, tight); b != nil {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// block returns n as a pandoc block. Paragraphs are Plain if tight is set.
+func block(n ast.Node, tight bool) interface{} {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		text := inlines(n)
+		switch {
+		case len(text) == 0:
+			return nil
+		case tight:
+			return el{"Plain", text}
+		default:
+			return el{"Para", text}
+		}
+	case *ast.Heading:
+		var classes []string
+		if n.IsTitle {
+			classes = []string{"title"}
+		}
+		if n.Unnumbered {
+			classes = append(classes, "unnumbered")
+		}
+		// the id is the anchor cross references link to, the label
+		// is kept for reading the document back
+		var kv map[string]string
+		if n.Label != "" {
+			kv = map[string]string{"label": n.Label}
+		}
+		return el{"Header", list(n.Level, attr(n.ID, classes, numbered(n.Number, kv)), inlines(n.Title))}
+	case *ast.UnorderedList:
+		return el{"BulletList", items(n.Items)}
+	case *ast.OrderedList:
+		return el{"OrderedList", list(list(1, el{T: "Decimal"}, el{T: "Period"}), items(n.Items))}
+	case *ast.Table:
+		return table(n)
+	case *ast.Code:
+		// the parser keeps the line breaks after and before the delimiters
+		text := strings.TrimSuffix(strings.TrimPrefix(n.Text, "\n"), "\n")
+		return el{"CodeBlock", list(attr(n.Label, nil, numbered(n.Number, nil)), text)}
+	case *ast.Image:
+		kv := make(map[string]string)
+		for k, v := range n.Attrs {
+			if k != "src" && k != "alt" && k != "title" {
+				kv[k] = v
+			}
+		}
+		img := el{"Image", list(attr(n.Label, nil, numbered(n.Number, kv)), words(n.Attrs["alt"]), list(n.Attrs["src"], n.Attrs["title"]))}
+		return el{"Para", list(img)}
+	case *ast.Video:
+		img := el{"Image", list(attr("", []string{"video"}, n.Attrs), list(), list(n.Source, ""))}
+		return el{"Para", list(img)}
+	case *ast.BlockQuote:
+		content := blocks(n.Blocks, false)
+		if n.Attribution != nil || n.Cite != "" {
+			var kv map[string]string
+			if n.Cite != "" {
+				kv = map[string]string{"cite": n.Cite}
+			}
+			text := list()
+			if n.Attribution != nil {
+				text = append(list(el{"Str", "—"}, el{T: "Space"}), inlines(n.Attribution)...)
+			}
+			content = append(content, el{"Div", list(attr("", []string{"attribution"}, kv), list(el{"Para", text}))})
+		}
+		return el{"BlockQuote", content}
+	case *ast.Callout:
+		content := list()
+		if n.Title != nil {
+			content = append(content, el{"Div", list(attr("", []string{"title"}, nil), list(el{"Para", inlines(n.Title)}))})
+		}
+		content = append(content, blocks(n.Blocks, false)...)
+		return el{"Div", list(attr("", []string{"callout", n.Kind}, nil), content)}
+	case *ast.Math:
+		return el{"Para", list(inline(n)...)}
+	case *ast.ThemeBreak:
+		return el{T: "HorizontalRule"}
+	case *ast.LineBreak:
+		return el{"Plain", list(el{T: "LineBreak"})}
+	default:
+		return nil
+	}
+}
+
+func items(items []*ast.ListItem) []interface{} {
+	out := list()
+	for _, x := range items {
+		// lists of single paragraphs are tight
+		out = append(out, blocks(x.Blocks, len(x.Blocks) <= 1))
+	}
+	return out
+}
+
+func table(t *ast.Table) interface{} {
+	cols := len(t.Headers)
+	for _, r := range t.Rows {
+		if len(r) > cols {
+			cols = len(r)
+		}
+	}
+	specs := list()
+	for i := 0; i < cols; i++ {
+		specs = append(specs, list(el{T: "AlignDefault"}, el{T: "ColWidthDefault"}))
+	}
+	row := func(cells []ast.TextNode) interface{} {
+		out := list()
+		for i := 0; i < cols; i++ {
+			content := list()
+			if i < len(cells) {
+				if text := inlines(cells[i]); len(text) > 0 {
+					content = append(content, el{"Plain", text})
+				}
+			}
+			out = append(out, list(noAttr, el{T: "AlignDefault"}, 1, 1, content))
+		}
+		return list(noAttr, out)
+	}
+	head := list()
+	if len(t.Headers) > 0 {
+		head = append(head, row(t.Headers))
+	}
+	body := list()
+	for _, r := range t.Rows {
+		body = append(body, row(r))
+	}
+	return el{"Table", list(
+		attr(t.Label, nil, numbered(t.Number, nil)),
+		list(nil, list()), // caption
+		specs,
+		list(noAttr, head),
+		list(list(noAttr, 0, list(), body)),
+		list(noAttr, list()),
+	)}
+}
+
+// inlines returns the inline elements of n with spaces between its items.
+func inlines(n ast.TextNode) []interface{} {
+	var out []interface{}
+	for _, x := range inline(n) {
+		if isSpace(x) && (len(out) == 0 || isSpace(out[len(out)-1])) {
+			continue
+		}
+		out = append(out, x)
+	}
+	for len(out) > 0 && isSpace(out[len(out)-1]) {
+		out = out[:len(out)-1]
+	}
+	return list(out...)
+}
+
+func isSpace(x interface{}) bool {
+	e, ok := x.(el)
+	return ok && (e.T == "Space" || e.T == "SoftBreak")
+}
+
+func inline(n ast.TextNode) []interface{} {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		var out []interface{}
+		for _, x := range n.Items {
+			out = append(out, inline(x)...)
+			out = append(out, el{T: "Space"})
+		}
+		return out
+	case *ast.Text:
+		text := words(n.Text)
+		switch {
+		case len(text) == 0:
+			return nil
+		case n.Style == ast.Bold:
+			return list(el{"Strong", text})
+		case n.Style == ast.Italic:
+			return list(el{"Emph", text})
+		case n.Style == ast.BoldAndItalic:
+			return list(el{"Strong", list(el{"Emph", text})})
+		default:
+			return text
+		}
+	case *ast.Anchor:
+		return list(el{"Link", list(noAttr, inlines(n.Text), list(n.URL, n.Title))})
+	case *ast.InlineCode:
+		return list(el{"Code", list(noAttr, n.Text)})
+	case *ast.Code:
+		return list(el{"Code", list(noAttr, strings.TrimSpace(n.Text))})
+	case *ast.Math:
+		kind := "InlineMath"
+		if n.Display {
+			kind = "DisplayMath"
+		}
+		return list(el{"Math", list(el{T: kind}, n.TeX)})
+	default:
+		return words(n.Bare())
+	}
+}
+
+// words splits s into Str, Space and SoftBreak elements.
+func words(s string) []interface{} {
+	out := list()
+	for len(s) > 0 {
+		i := strings.IndexFunc(s, unicode.IsSpace)
+		if i < 0 {
+			i = len(s)
+		}
+		if i > 0 {
+			out = append(out, el{"Str", s[:i]})
+			s = s[i:]
+			continue
+		}
+		j := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsSpace(r) })
+		if j < 0 {
+			j = len(s)
+		}
+		if len(out) > 0 && j < len(s) {
+			if strings.Contains(s[:j], "\n") {
+				out = append(out, el{T: "SoftBreak"})
+			} else {
+				out = append(out, el{T: "Space"})
+			}
+		}
+		s = s[j:]
+	}
+	return out
+}
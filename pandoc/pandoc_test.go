@@ -0,0 +1,70 @@
+package pandoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/insomnimus/typeup/printer"
+	"github.com/insomnimus/typeup/transpiler"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// golden calls f with the contents of each file in testdata/dir with
+// the extension ext and checks that the result is the file of the same
+// name with the extension want.
+func golden(t *testing.T, dir, ext, want string, f func([]byte) (string, error)) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("testdata", dir, "*"+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test data")
+	}
+	for _, path := range files {
+		in, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := os.ReadFile(strings.TrimSuffix(path, ext) + want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f(in)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+		} else if got != string(expected) {
+			t.Errorf("%s:\ngot:\n%s\nwant:\n%s", path, got, expected)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	golden(t, "write", ".tup", ".json", func(src []byte) (string, error) {
+		d := transpiler.Parse(string(src))
+		if _, err := d.Apply(nil); err != nil {
+			return "", err
+		}
+		data, err := Marshal(d.Nodes, d.Meta)
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, data, "", "\t"); err != nil {
+			return "", err
+		}
+		return out.String() + "\n", nil
+	})
+}
+
+func TestUnmarshal(t *testing.T) {
+	golden(t, "read", ".json", ".tup", func(data []byte) (string, error) {
+		nodes, meta, err := Unmarshal(data)
+		if err != nil {
+			return "", err
+		}
+		return printer.Print(nodes, meta), nil
+	})
+}
@@ -0,0 +1,683 @@
+package pandoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"strings"
+)
+
+// elem is a pandoc element as read by Unmarshal.
+type elem struct {
+	T string          `json:"t"`
+	C json.RawMessage `json:"c"`
+}
+
+// tuple decodes the JSON array data into dst, one element each.
+func tuple(data json.RawMessage, dst ...interface{}) error {
+	var xs []json.RawMessage
+	if err := json.Unmarshal(data, &xs); err != nil {
+		return err
+	}
+	if len(xs) != len(dst) {
+		return fmt.Errorf("expected %d fields, got %d", len(dst), len(xs))
+	}
+	for i, x := range xs {
+		if err := json.Unmarshal(x, dst[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type attrs struct {
+	ID      string
+	Classes []string
+	KV      map[string]string
+}
+
+func (a *attrs) UnmarshalJSON(data []byte) error {
+	var kv [][2]string
+	if err := tuple(data, &a.ID, &a.Classes, &kv); err != nil {
+		return fmt.Errorf("attr: %w", err)
+	}
+	a.KV = make(map[string]string)
+	for _, x := range kv {
+		a.KV[x[0]] = x[1]
+	}
+	return nil
+}
+
+func (a *attrs) has(class string) bool {
+	for _, c := range a.Classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Unmarshal reads a document in pandoc JSON. String meta data values
+// and the plain text of inline ones are kept; lists and maps are dropped.
+// If there is a title, it is made the title heading of the document.
+func Unmarshal(data []byte) ([]ast.Node, map[string]string, error) {
+	var doc struct {
+		Version []int                      `json:"pandoc-api-version"`
+		Meta    map[string]json.RawMessage `json:"meta"`
+		Blocks  []elem                     `json:"blocks"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	// tables took their current form in 1.21
+	if len(doc.Version) < 2 || doc.Version[0] != 1 || doc.Version[1] < 21 {
+		return nil, nil, fmt.Errorf("unsupported pandoc-api-version %v", doc.Version)
+	}
+	meta := make(map[string]string)
+	for k, v := range doc.Meta {
+		var e elem
+		if err := json.Unmarshal(v, &e); err != nil {
+			return nil, nil, fmt.Errorf("meta %s: %w", k, err)
+		}
+		if s, ok, err := metaString(e); err != nil {
+			return nil, nil, fmt.Errorf("meta %s: %w", k, err)
+		} else if ok {
+			meta[k] = s
+		}
+	}
+	nodes, err := readBlocks(doc.Blocks)
+	if err != nil {
+		return nil, nil, err
+	}
+	hasTitle := false
+	for _, n := range nodes {
+		if h, ok := n.(*ast.Heading); ok && h.IsTitle {
+			hasTitle = true
+		}
+	}
+	if title := meta["title"]; title != "" && !hasTitle {
+		h := &ast.Heading{
+			Title:   &ast.TextBlock{Items: []ast.TextNode{&ast.Text{Text: title}}},
+			Level:   1,
+			IsTitle: true,
+		}
+		nodes = append([]ast.Node{h}, nodes...)
+	}
+	return nodes, meta, nil
+}
+
+func metaString(e elem) (string, bool, error) {
+	switch e.T {
+	case "MetaString":
+		var s string
+		err := json.Unmarshal(e.C, &s)
+		return s, err == nil, err
+	case "MetaBool":
+		var b bool
+		err := json.Unmarshal(e.C, &b)
+		return fmt.Sprint(b), err == nil, err
+	case "MetaInlines":
+		var xs []elem
+		if err := json.Unmarshal(e.C, &xs); err != nil {
+			return "", false, err
+		}
+		s, err := plain(xs)
+		return s, err == nil, err
+	default:
+		return "", false, nil
+	}
+}
+
+func readBlocks(xs []elem) ([]ast.Node, error) {
+	var out []ast.Node
+	for _, x := range xs {
+		nodes, err := readBlock(x)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", x.T, err)
+		}
+		out = append(out, nodes...)
+	}
+	return out, nil
+}
+
+func readBlock(e elem) ([]ast.Node, error) {
+	switch e.T {
+	case "Plain", "Para":
+		var xs []elem
+		if err := json.Unmarshal(e.C, &xs); err != nil {
+			return nil, err
+		}
+		if len(xs) == 1 {
+			if n, ok, err := readMedia(xs[0]); ok || err != nil {
+				return []ast.Node{n}, err
+			}
+		}
+		text, err := readInlines(xs)
+		if err != nil || len(text.Items) == 0 {
+			return nil, err
+		}
+		return []ast.Node{text}, nil
+	case "LineBlock":
+		var lines [][]elem
+		if err := json.Unmarshal(e.C, &lines); err != nil {
+			return nil, err
+		}
+		// a paragraph for each line
+		var out []ast.Node
+		for _, ln := range lines {
+			text, err := readInlines(ln)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, text)
+		}
+		return out, nil
+	case "CodeBlock":
+		var (
+			a    attrs
+			text string
+		)
+		if err := tuple(e.C, &a, &text); err != nil {
+			return nil, err
+		}
+		return []ast.Node{&ast.Code{Text: "\n" + text + "\n", Label: a.ID, Number: a.KV["number"]}}, nil
+	case "Header":
+		var (
+			level int
+			a     attrs
+			xs    []elem
+		)
+		if err := tuple(e.C, &level, &a, &xs); err != nil {
+			return nil, err
+		}
+		title, err := readInlines(xs)
+		if err != nil {
+			return nil, err
+		}
+		return []ast.Node{&ast.Heading{
+			Title:      title,
+			Level:      level,
+			ID:         a.ID,
+			IsTitle:    a.has("title"),
+			Unnumbered: a.has("unnumbered"),
+			Label:      a.KV["label"],
+			Number:     a.KV["number"],
+		}}, nil
+	case "BulletList":
+		var items [][]elem
+		if err := json.Unmarshal(e.C, &items); err != nil {
+			return nil, err
+		}
+		list, err := readItems(items)
+		return []ast.Node{&ast.UnorderedList{Items: list}}, err
+	case "OrderedList":
+		var (
+			listAttrs json.RawMessage
+			items     [][]elem
+		)
+		if err := tuple(e.C, &listAttrs, &items); err != nil {
+			return nil, err
+		}
+		list, err := readItems(items)
+		return []ast.Node{&ast.OrderedList{Items: list}}, err
+	case "DefinitionList":
+		// terms become paragraphs followed by their definitions
+		var raw []json.RawMessage
+		if err := json.Unmarshal(e.C, &raw); err != nil {
+			return nil, err
+		}
+		var out []ast.Node
+		for _, x := range raw {
+			var (
+				term []elem
+				defs [][]elem
+			)
+			if err := tuple(x, &term, &defs); err != nil {
+				return nil, err
+			}
+			text, err := readInlines(term)
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range text.Items {
+				if t, ok := t.(*ast.Text); ok && t.Style == ast.NoStyle {
+					t.Style = ast.Bold
+				}
+			}
+			out = append(out, text)
+			list, err := readItems(defs)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, &ast.UnorderedList{Items: list})
+		}
+		return out, nil
+	case "BlockQuote":
+		var xs []elem
+		if err := json.Unmarshal(e.C, &xs); err != nil {
+			return nil, err
+		}
+		q := &ast.BlockQuote{}
+		if n := len(xs); n > 0 && xs[n-1].T == "Div" {
+			var (
+				a       attrs
+				content []elem
+			)
+			if err := tuple(xs[n-1].C, &a, &content); err != nil {
+				return nil, err
+			}
+			if a.has("attribution") {
+				xs = xs[:n-1]
+				q.Cite = a.KV["cite"]
+				text, err := readInlines(flatten(content))
+				if err != nil {
+					return nil, err
+				}
+				if len(text.Items) > 0 {
+					if t, ok := text.Items[0].(*ast.Text); ok && t.Style == ast.NoStyle {
+						t.Text = strings.TrimSpace(strings.TrimPrefix(t.Text, "—"))
+						if t.Text == "" {
+							text.Items = text.Items[1:]
+						}
+					}
+					q.Attribution = text
+				}
+			}
+		}
+		blocks, err := readBlocks(xs)
+		q.Blocks = blocks
+		return []ast.Node{q}, err
+	case "HorizontalRule":
+		return []ast.Node{&ast.ThemeBreak{}}, nil
+	case "Table":
+		t, err := readTable(e.C)
+		return []ast.Node{t}, err
+	case "Figure":
+		var (
+			a       attrs
+			caption json.RawMessage
+			xs      []elem
+		)
+		if err := tuple(e.C, &a, &caption, &xs); err != nil {
+			return nil, err
+		}
+		nodes, err := readBlocks(xs)
+		// the id of a figure labels the image in it
+		if img, ok := single(nodes).(*ast.Image); ok && img.Label == "" {
+			img.Label = a.ID
+		}
+		return nodes, err
+	case "Div":
+		var (
+			a  attrs
+			xs []elem
+		)
+		if err := tuple(e.C, &a, &xs); err != nil {
+			return nil, err
+		}
+		kind := ""
+		for _, c := range a.Classes {
+			if alertKinds[c] || a.has("callout") && c != "callout" {
+				kind = c
+				break
+			}
+		}
+		if kind == "" {
+			return readBlocks(xs)
+		}
+		c := &ast.Callout{Kind: kind}
+		if len(xs) > 0 && xs[0].T == "Div" {
+			var (
+				ta      attrs
+				content []elem
+			)
+			if err := tuple(xs[0].C, &ta, &content); err != nil {
+				return nil, err
+			}
+			if ta.has("title") {
+				xs = xs[1:]
+				text, err := readInlines(flatten(content))
+				if err != nil {
+					return nil, err
+				}
+				c.Title = text
+			}
+		}
+		blocks, err := readBlocks(xs)
+		c.Blocks = blocks
+		return []ast.Node{c}, err
+	case "RawBlock", "Null":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown block type")
+	}
+}
+
+// single returns the only node of nodes, or nil.
+func single(nodes []ast.Node) ast.Node {
+	if len(nodes) != 1 {
+		return nil
+	}
+	return nodes[0]
+}
+
+// alertKinds are the classes of the Divs pandoc makes of GitHub alerts.
+var alertKinds = map[string]bool{
+	"note":      true,
+	"tip":       true,
+	"important": true,
+	"warning":   true,
+	"caution":   true,
+}
+
+// flatten returns the inlines of the Plain and Para blocks in xs.
+func flatten(xs []elem) []elem {
+	var out []elem
+	for _, x := range xs {
+		if x.T != "Plain" && x.T != "Para" {
+			continue
+		}
+		var content []elem
+		if json.Unmarshal(x.C, &content) == nil {
+			if len(out) > 0 {
+				out = append(out, elem{T: "Space"})
+			}
+			out = append(out, content...)
+		}
+	}
+	return out
+}
+
+// readMedia returns the block an image or display math alone in a
+// paragraph stands for.
+func readMedia(e elem) (ast.Node, bool, error) {
+	switch e.T {
+	case "Image":
+		var (
+			a      attrs
+			alt    []elem
+			target [2]string
+		)
+		if err := tuple(e.C, &a, &alt, &target); err != nil {
+			return nil, true, err
+		}
+		if a.has("video") {
+			return &ast.Video{Source: target[0], Attrs: a.KV}, true, nil
+		}
+		img := &ast.Image{Attrs: a.KV, Label: a.ID, Number: a.KV["number"]}
+		delete(img.Attrs, "number")
+		img.Attrs["src"] = target[0]
+		if target[1] != "" {
+			img.Attrs["title"] = target[1]
+		}
+		text, err := plain(alt)
+		if text != "" {
+			img.Attrs["alt"] = text
+		}
+		return img, true, err
+	case "Math":
+		var (
+			kind elem
+			tex  string
+		)
+		if err := tuple(e.C, &kind, &tex); err != nil {
+			return nil, true, err
+		}
+		if kind.T == "DisplayMath" {
+			return &ast.Math{TeX: tex, Display: true}, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func readItems(items [][]elem) ([]*ast.ListItem, error) {
+	var out []*ast.ListItem
+	for _, x := range items {
+		blocks, err := readBlocks(x)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, &ast.ListItem{Blocks: blocks})
+	}
+	return out, nil
+}
+
+func readTable(data json.RawMessage) (*ast.Table, error) {
+	var (
+		a       attrs
+		caption json.RawMessage
+		specs   json.RawMessage
+		head    json.RawMessage
+		bodies  []json.RawMessage
+		foot    json.RawMessage
+	)
+	if err := tuple(data, &a, &caption, &specs, &head, &bodies, &foot); err != nil {
+		return nil, err
+	}
+	// head and foot are [attr, rows], a body is [attr, int, head rows, rows]
+	rowsOf := func(data json.RawMessage, fields int, idx ...int) ([][]ast.TextNode, error) {
+		dst := make([]interface{}, fields)
+		var all []json.RawMessage
+		for i := range dst {
+			dst[i] = new(json.RawMessage)
+		}
+		if err := tuple(data, dst...); err != nil {
+			return nil, err
+		}
+		for _, i := range idx {
+			var rows []json.RawMessage
+			if err := json.Unmarshal(*dst[i].(*json.RawMessage), &rows); err != nil {
+				return nil, err
+			}
+			all = append(all, rows...)
+		}
+		var out [][]ast.TextNode
+		for _, r := range all {
+			var (
+				ra    attrs
+				cells []json.RawMessage
+			)
+			if err := tuple(r, &ra, &cells); err != nil {
+				return nil, err
+			}
+			var row []ast.TextNode
+			for _, c := range cells {
+				var (
+					ca             attrs
+					align          elem
+					rowspan, cspan int
+					content        []elem
+				)
+				if err := tuple(c, &ca, &align, &rowspan, &cspan, &content); err != nil {
+					return nil, err
+				}
+				text, err := readInlines(flatten(content))
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, text)
+			}
+			out = append(out, row)
+		}
+		return out, nil
+	}
+
+	t := &ast.Table{Label: a.ID, Number: a.KV["number"]}
+	rows, err := rowsOf(head, 2, 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bodies {
+		body, err := rowsOf(b, 4, 2, 3)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, body...)
+	}
+	footer, err := rowsOf(foot, 2, 1)
+	if err != nil {
+		return nil, err
+	}
+	rows = append(rows, footer...)
+	if len(rows) > 0 {
+		t.Headers, t.Rows = rows[0], rows[1:]
+	}
+	return t, nil
+}
+
+// readInlines returns xs as a text block, with a Text item for each run of
+// text in the same style.
+func readInlines(xs []elem) (*ast.TextBlock, error) {
+	var (
+		items []ast.TextNode
+		run   strings.Builder
+		style ast.TextStyle
+	)
+	flush := func() {
+		if s := strings.TrimSpace(run.String()); s != "" {
+			items = append(items, &ast.Text{Style: style, Text: s})
+		}
+		run.Reset()
+	}
+	var walk func(xs []elem, st ast.TextStyle) error
+	walk = func(xs []elem, st ast.TextStyle) error {
+		for _, x := range xs {
+			if st != style {
+				flush()
+				style = st
+			}
+			switch x.T {
+			case "Str":
+				var s string
+				if err := json.Unmarshal(x.C, &s); err != nil {
+					return err
+				}
+				run.WriteString(s)
+			case "Space":
+				run.WriteString(" ")
+			case "SoftBreak", "LineBreak":
+				run.WriteString("\n")
+			case "Emph", "Strong":
+				var content []elem
+				if err := json.Unmarshal(x.C, &content); err != nil {
+					return err
+				}
+				inner := st
+				switch {
+				case x.T == "Emph" && st == ast.Bold, x.T == "Strong" && st == ast.Italic:
+					inner = ast.BoldAndItalic
+				case x.T == "Emph" && st == ast.NoStyle:
+					inner = ast.Italic
+				case x.T == "Strong" && st == ast.NoStyle:
+					inner = ast.Bold
+				}
+				if err := walk(content, inner); err != nil {
+					return err
+				}
+			case "Underline", "Strikeout", "Superscript", "Subscript", "SmallCaps":
+				var content []elem
+				if err := json.Unmarshal(x.C, &content); err != nil {
+					return err
+				}
+				if err := walk(content, st); err != nil {
+					return err
+				}
+			case "Span":
+				var (
+					a       attrs
+					content []elem
+				)
+				if err := tuple(x.C, &a, &content); err != nil {
+					return err
+				}
+				if err := walk(content, st); err != nil {
+					return err
+				}
+			case "Quoted":
+				var (
+					kind    elem
+					content []elem
+				)
+				if err := tuple(x.C, &kind, &content); err != nil {
+					return err
+				}
+				open, close := "“", "”"
+				if kind.T == "SingleQuote" {
+					open, close = "‘", "’"
+				}
+				run.WriteString(open)
+				if err := walk(content, st); err != nil {
+					return err
+				}
+				if style != st {
+					flush()
+					style = st
+				}
+				run.WriteString(close)
+			case "Cite":
+				var (
+					cites   json.RawMessage
+					content []elem
+				)
+				if err := tuple(x.C, &cites, &content); err != nil {
+					return err
+				}
+				if err := walk(content, st); err != nil {
+					return err
+				}
+			case "Code":
+				var (
+					a    attrs
+					text string
+				)
+				if err := tuple(x.C, &a, &text); err != nil {
+					return err
+				}
+				flush()
+				items = append(items, &ast.InlineCode{Text: text})
+			case "Math":
+				var (
+					kind elem
+					tex  string
+				)
+				if err := tuple(x.C, &kind, &tex); err != nil {
+					return err
+				}
+				flush()
+				items = append(items, &ast.Math{TeX: tex, Display: kind.T == "DisplayMath"})
+			case "Link", "Image":
+				// typeup has no inline images, they become links
+				var (
+					a       attrs
+					content []elem
+					target  [2]string
+				)
+				if err := tuple(x.C, &a, &content, &target); err != nil {
+					return err
+				}
+				text, err := readInlines(content)
+				if err != nil {
+					return err
+				}
+				flush()
+				items = append(items, &ast.Anchor{Text: text, URL: target[0], Title: target[1]})
+			case "RawInline", "Note":
+			default:
+				return fmt.Errorf("unknown inline type %q", x.T)
+			}
+		}
+		return nil
+	}
+	err := walk(xs, ast.NoStyle)
+	flush()
+	return &ast.TextBlock{Items: items}, err
+}
+
+// plain returns the text of xs without formatting.
+func plain(xs []elem) (string, error) {
+	text, err := readInlines(xs)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text.Bare()), nil
+}
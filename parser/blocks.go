@@ -0,0 +1,122 @@
+package parser
+
+import "github.com/insomnimus/typeup/ast"
+
+// Block is a top level node along with the part of the document
+// it was parsed from. Node is nil for a trailing block that consists only
+// of meta data or ignored text.
+type Block struct {
+	Node       ast.Node
+	Start, End int // rune offsets, End is exclusive
+	Warnings   []*Warning
+	// Meta holds the meta data keys set while parsing the block.
+	Meta map[string]string
+
+	far int
+}
+
+// Blocks parses the whole document s into its top level blocks.
+func Blocks(s string) []*Block {
+	p := New(s)
+	return p.blocks(nil)
+}
+
+// Reparse updates blocks, previously parsed from an older version of the
+// document, after the runes in [start, end) of the old version were replaced
+// to produce s. Only the blocks affected by the edit are parsed again;
+// the rest are reused with their offsets shifted, so blocks must not be
+// used after the call.
+func Reparse(blocks []*Block, s string, start, end, newLen int) []*Block {
+	p := New(s)
+	delta := newLen - (end - start)
+
+	// a block can be affected by the edit if its parser looked at the
+	// edited text. Step back one more block since lookahead on the
+	// last line of a block is not always recorded.
+	i := 0
+	for i < len(blocks) && blocks[i].far < start {
+		i++
+	}
+	if i > 0 {
+		i--
+	}
+	kept := append([]*Block(nil), blocks[:i]...)
+	if i < len(blocks) {
+		p.setPos(blocks[i].Start)
+	}
+	for _, b := range kept {
+		for _, w := range b.Warnings {
+			w.doc = p.doc
+		}
+	}
+	// the old blocks that start after the edit, where parsing can stop
+	// if it arrives at the same place.
+	rest := blocks[i:]
+	for len(rest) > 0 && rest[0].Start <= end {
+		rest = rest[1:]
+	}
+	fresh := p.blocks(func(pos int) bool {
+		for len(rest) > 0 && rest[0].Start+delta < pos {
+			rest = rest[1:]
+		}
+		return len(rest) > 0 && rest[0].Start+delta == pos
+	})
+
+	out := append(kept, fresh...)
+	if len(fresh) > 0 && len(rest) > 0 && rest[0].Start+delta == fresh[len(fresh)-1].End {
+		for _, b := range rest {
+			b.Start += delta
+			b.End += delta
+			b.far += delta
+			for _, w := range b.Warnings {
+				w.pos += delta
+				w.doc = p.doc
+			}
+			out = append(out, b)
+		}
+	}
+	// ids are unique across the document, headings nested in other
+	// blocks included, and given in document order
+	p.ids = make(map[string]int)
+	for _, b := range out {
+		ast.Inspect(b.Node, func(n interface{}) bool {
+			h, ok := n.(*ast.Heading)
+			if ok {
+				h.ID = p.headingID(h.Title.Bare())
+			}
+			return !ok
+		})
+	}
+	return out
+}
+
+// blocks parses blocks until the end of the document or until stop
+// returns true for the position after a block.
+func (p *Parser) blocks(stop func(pos int) bool) []*Block {
+	var out []*Block
+	for {
+		start := p.pos
+		nwarn := len(p.warnings)
+		p.far = p.readpos
+		p.meta = make(map[string]string)
+		node := p.Next()
+		if node == nil && len(p.meta) == 0 && len(p.warnings) == nwarn {
+			return out
+		}
+		end := p.pos
+		if node == nil {
+			end = len(p.doc)
+		}
+		out = append(out, &Block{
+			Node:     node,
+			Start:    start,
+			End:      end,
+			Warnings: p.warnings[nwarn:len(p.warnings):len(p.warnings)],
+			Meta:     p.meta,
+			far:      p.far,
+		})
+		if node == nil || stop != nil && stop(end) {
+			return out
+		}
+	}
+}
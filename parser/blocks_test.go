@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"testing"
+)
+
+// headingIDs returns the ids of the headings in blocks, nested ones
+// included, in document order.
+func headingIDs(blocks []*Block) []string {
+	var ids []string
+	for _, b := range blocks {
+		ast.Inspect(b.Node, func(n interface{}) bool {
+			if h, ok := n.(*ast.Heading); ok {
+				ids = append(ids, h.ID)
+			}
+			return true
+		})
+	}
+	return ids
+}
+
+func TestReparseNestedHeadings(t *testing.T) {
+	const old = "# Intro\n\n:::note\n# Intro\n:::\n\n[\n(\n# Intro\n)\n]\n\n| # Intro\n\n# Intro\n"
+	tests := []struct {
+		name       string
+		start, end int
+		insert     string
+	}{
+		{"before", 0, 0, "# Intro\n\n"},
+		{"inside the callout", 17, 17, "# Intro\n"},
+		{"after", len(old), len(old), "\n# Intro\n"},
+		{"removing the first heading", 0, 9, ""},
+	}
+	for _, tt := range tests {
+		src := old[:tt.start] + tt.insert + old[tt.end:]
+		got := headingIDs(Reparse(Blocks(old), src, tt.start, tt.end, len(tt.insert)))
+		want := headingIDs(Blocks(src))
+		if len(want) < 4 {
+			t.Fatalf("%s: test document has %d headings, want at least 4", tt.name, len(want))
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d headings, want %d", tt.name, len(got), len(want))
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: got ids %v, want %v", tt.name, got, want)
+				break
+			}
+		}
+	}
+}
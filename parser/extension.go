@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"sort"
+)
+
+// BlockParser parses a kind of block that is not built into typeup, such
+// as a diagram. The node it returns is usually of a type of its own,
+// rendered through render.Overrides.
+type BlockParser interface {
+	// Trigger returns the text the block starts with. A paragraph ends
+	// at a line starting with it.
+	Trigger() string
+	// Priority orders the block parsers with the same first rune of
+	// their trigger, the highest first. Built-in blocks have priority 0:
+	// block parsers of a higher priority are tried before them and
+	// shadow them, the others only if no built-in block matches.
+	Priority() int
+	// Parse parses the block at the position of p, at the start of the
+	// trigger, and reports whether there is one. The parser is put back
+	// where it was if Parse returns false, so it may read ahead freely.
+	Parse(p *Parser) (ast.Node, bool)
+}
+
+// Register adds block parsers to p.
+func (p *Parser) Register(bps ...BlockParser) {
+	if p.exts == nil {
+		p.exts = make(map[rune][]BlockParser)
+	}
+	for _, bp := range bps {
+		trigger := []rune(bp.Trigger())
+		if len(trigger) == 0 {
+			panic("parser: block parser with an empty trigger")
+		}
+		list := append(p.exts[trigger[0]], bp)
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Priority() > list[j].Priority()
+		})
+		p.exts[trigger[0]] = list
+	}
+}
+
+// InlineParser parses a kind of text element that is not built into
+// typeup, such as a mention, as a TextNode usually of a type of its own.
+type InlineParser interface {
+	// Trigger returns the text the element starts with.
+	Trigger() string
+	// Priority orders the inline parsers like BlockParser.Priority.
+	Priority() int
+	// Parse parses the element at s[start], the start of the trigger,
+	// returning it and the index in s of its last rune. An index not
+	// greater than start means there is none.
+	Parse(s []rune, start int) (ast.TextNode, int)
+}
+
+// RegisterInline adds inline parsers to p.
+func (p *Parser) RegisterInline(ips ...InlineParser) {
+	if p.inlines == nil {
+		p.inlines = make(map[rune][]InlineParser)
+	}
+	for _, ip := range ips {
+		trigger := []rune(ip.Trigger())
+		if len(trigger) == 0 {
+			panic("parser: inline parser with an empty trigger")
+		}
+		list := append(p.inlines[trigger[0]], ip)
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Priority() > list[j].Priority()
+		})
+		p.inlines[trigger[0]] = list
+	}
+}
+
+// extension parses the block at the current position with the registered
+// block parsers of a priority above that of the built-in blocks if high
+// is set, or else with the others.
+func (p *Parser) extension(high bool) (ast.Node, bool) {
+	for _, bp := range p.exts[p.ch] {
+		if bp.Priority() > 0 != high || !p.aheadIs(bp.Trigger()) {
+			continue
+		}
+		start := p.pos
+		restore := p.snapshot()
+		// a block must consume something or Next would never advance
+		if node, ok := bp.Parse(p); ok && node != nil && p.pos > start {
+			return node, true
+		}
+		restore()
+		p.setPos(start)
+	}
+	return nil, false
+}
+
+// inlineExtension parses the text element at s[i] like extension.
+func (p *Parser) inlineExtension(s []rune, i int, high bool) (ast.TextNode, int) {
+	for _, ip := range p.inlines[s[i]] {
+		trigger := []rune(ip.Trigger())
+		if ip.Priority() > 0 != high || i+len(trigger) > len(s) || string(s[i:i+len(trigger)]) != string(trigger) {
+			continue
+		}
+		if node, pos := ip.Parse(s, i); node != nil && pos > i && pos < len(s) {
+			return node, pos
+		}
+	}
+	return nil, -1
+}
+
+// triggered reports whether a registered block parser's trigger is at
+// the current position.
+func (p *Parser) triggered() bool {
+	for _, bp := range p.exts[p.ch] {
+		if p.aheadIs(bp.Trigger()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Char returns the rune at the position of p, or 0 at the end of the
+// document.
+func (p *Parser) Char() rune {
+	return p.ch
+}
+
+// Peek returns the rune n runes after the position of p, or 0 past the
+// end of the document.
+func (p *Parser) Peek(n int) rune {
+	return p.peekN(n)
+}
+
+// Read advances p by one rune.
+func (p *Parser) Read() {
+	p.read()
+}
+
+// SetPos moves p to the offset pos, in runes, such as one returned by Pos.
+func (p *Parser) SetPos(pos int) {
+	if pos >= len(p.doc) {
+		p.pos, p.readpos, p.ch = len(p.doc), len(p.doc)+1, 0
+		return
+	}
+	p.setPos(pos)
+}
+
+// AheadIs reports whether the document continues with s at the position of p.
+func (p *Parser) AheadIs(s string) bool {
+	return p.aheadIs(s)
+}
+
+// IsStartOfLine reports whether p is at the start of a line.
+func (p *Parser) IsStartOfLine() bool {
+	return p.isStartOfLine()
+}
+
+// ReadLine returns the rest of the current line and moves p to the start
+// of the next one.
+func (p *Parser) ReadLine() string {
+	s := p.readLineRest()
+	p.read()
+	return s
+}
+
+// Warn reports a problem at the offset pos, in runes.
+func (p *Parser) Warn(pos int, format string, args ...interface{}) {
+	p.warnAt(pos, format, args...)
+}
+
+// Text parses s as the text of a paragraph.
+func (p *Parser) Text(s string) *ast.TextBlock {
+	return p.processText(s)
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"github.com/insomnimus/typeup/ast"
 	"regexp"
 	"strings"
@@ -17,6 +18,9 @@ func (p *Parser) read() {
 	}
 	p.pos = p.readpos
 	p.readpos++
+	if p.readpos > p.far {
+		p.far = p.readpos
+	}
 }
 
 func (p *Parser) peek() rune {
@@ -50,11 +54,14 @@ func (p *Parser) searchLineUntil(c rune) (string, int) {
 			break
 		}
 	}
+	if end < 0 {
+		return "", end
+	}
 	return string(p.doc[p.readpos:end]), end
 }
 
 func (p *Parser) aheadIs(s string) bool {
-	if len(s)+p.pos >= len(p.doc) {
+	if len(s)+p.pos > len(p.doc) {
 		return false
 	}
 	return string(p.doc[p.pos:p.pos+len(s)]) == s
@@ -93,6 +100,14 @@ func isEmpty(s string) bool {
 	return strings.TrimSpace(s) == ""
 }
 
+func isEmptyNode(n ast.Node) bool {
+	if n == nil {
+		return true
+	}
+	tb, ok := n.(*ast.TextBlock)
+	return ok && len(tb.Items) == 0
+}
+
 func (p *Parser) setPos(pos int) {
 	if pos < 0 {
 		return
@@ -103,6 +118,74 @@ func (p *Parser) setPos(pos int) {
 	p.pos = pos
 	p.readpos = pos + 1
 	p.ch = p.doc[pos]
+	if p.readpos > p.far {
+		p.far = p.readpos
+	}
+}
+
+// snapshot returns a function that undoes the changes made to the
+// warnings, meta data and heading ids after the call, for when a block
+// holding other blocks turns out not to be one.
+func (p *Parser) snapshot() func() {
+	warnings := len(p.warnings)
+	meta := make(map[string]string, len(p.meta))
+	for k, v := range p.meta {
+		meta[k] = v
+	}
+	ids := make(map[string]int, len(p.ids))
+	for k, v := range p.ids {
+		ids[k] = v
+	}
+	return func() {
+		p.warnings = p.warnings[:warnings]
+		for k := range p.meta {
+			delete(p.meta, k)
+		}
+		for k, v := range meta {
+			p.meta[k] = v
+		}
+		for k := range p.ids {
+			delete(p.ids, k)
+		}
+		for k, v := range ids {
+			p.ids[k] = v
+		}
+	}
+}
+
+// headingID returns a unique id for a heading with the given title,
+// suitable for linking to it with a fragment.
+func (p *Parser) headingID(title string) string {
+	id := Slug(title)
+	n := p.ids[id]
+	p.ids[id]++
+	if n > 0 {
+		return fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
+}
+
+// Slug returns s in lower case with the runs of characters other than
+// letters and digits replaced by a dash, as used for heading ids.
+func Slug(s string) string {
+	var buff strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if dash && buff.Len() > 0 {
+				buff.WriteRune('-')
+			}
+			dash = false
+			buff.WriteRune(c)
+		default:
+			dash = true
+		}
+	}
+	if buff.Len() == 0 {
+		return "section"
+	}
+	return buff.String()
 }
 
 func (p *Parser) lineLastChar() rune {
@@ -120,7 +203,7 @@ func (p *Parser) lineLastChar() rune {
 	return lastChar
 }
 
-func hasAnchor(s []rune, start int) (*ast.Anchor, int) {
+func (p *Parser) hasAnchor(s []rune, start int) (*ast.Anchor, int) {
 	if s[start] != '[' || start+1 >= len(s) || start < 0 {
 		return nil, -1
 	}
@@ -148,6 +231,9 @@ func hasAnchor(s []rune, start int) (*ast.Anchor, int) {
 	if text == "" {
 		return nil, -1
 	}
+	if label, end := p.refLabel(s, pos+1); end > 0 {
+		return p.refAnchor(text, label), end
+	}
 	fields := strings.Fields(text)
 	switch len(fields) {
 	case 0: // impossible
@@ -160,12 +246,28 @@ func hasAnchor(s []rune, start int) (*ast.Anchor, int) {
 	default:
 		text = strings.Join(fields[:len(fields)-1], " ")
 		return &ast.Anchor{
-			Text: processText(text),
+			Text: p.processText(text),
 			URL:  fields[len(fields)-1],
 		}, pos
 	}
 }
 
+// hasRef parses a cross reference, "[@label]", at s[start].
+func hasRef(s []rune, start int) (*ast.Ref, int) {
+	if start+2 >= len(s) || s[start] != '[' || s[start+1] != '@' {
+		return nil, -1
+	}
+	for i := start + 2; i < len(s); i++ {
+		switch {
+		case s[i] == ']' && i > start+2:
+			return &ast.Ref{Label: string(s[start+2 : i])}, i
+		case s[i] == ']', unicode.IsSpace(s[i]), s[i] == '[':
+			return nil, -1
+		}
+	}
+	return nil, -1
+}
+
 func hasItalic(s []rune, start int) (*ast.Text, int) {
 	if s[start] != '*' || start+1 >= len(s) || start < 0 {
 		return nil, -1
@@ -237,6 +339,17 @@ func (p *Parser) readLineRest() string {
 	return buff.String()
 }
 
+// isSpaceUntilLF reports whether s[i:] is only whitespace until the end
+// of the line.
+func isSpaceUntilLF(s []rune, i int) bool {
+	for ; i < len(s) && s[i] != '\n'; i++ {
+		if !unicode.IsSpace(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Parser) isSpaceUntilLF() bool {
 	if p.readpos >= len(p.doc) {
 		return true
@@ -383,3 +496,26 @@ func hasInlineCode(s []rune, start int) (*ast.InlineCode, int) {
 		return nil, -1
 	}
 }
+
+// hasMath reports inline math starting at s[start], following pandoc's
+// rules: the opening '$' must be followed by a non-space and the closing
+// '$' must come after a non-space and not be followed by a digit.
+func hasMath(s []rune, start int) (*ast.Math, int) {
+	if start+1 >= len(s) || s[start] != '$' || s[start+1] == '$' || unicode.IsSpace(s[start+1]) {
+		return nil, -1
+	}
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\n' && i+1 < len(s) && s[i+1] == '\n':
+			return nil, -1
+		case s[i] == '\\':
+			i++
+		case s[i] == '$':
+			if unicode.IsSpace(s[i-1]) || i+1 < len(s) && unicode.IsDigit(s[i+1]) {
+				continue
+			}
+			return &ast.Math{TeX: string(s[start+1 : i])}, i
+		}
+	}
+	return nil, -1
+}
@@ -2,8 +2,11 @@ package parser
 
 import (
 	"github.com/insomnimus/typeup/ast"
+	"github.com/insomnimus/typeup/mathml"
+	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type Parser struct {
@@ -12,6 +15,13 @@ type Parser struct {
 	pos, readpos int
 	warnings     []*Warning
 	meta         map[string]string
+	ids          map[string]int
+	labels       map[string]bool
+	items        int // nesting depth of block list items
+	far          int // the furthest position read, see Blocks
+	// registered block and inline parsers by the first rune of their trigger
+	exts    map[rune][]BlockParser
+	inlines map[rune][]InlineParser
 }
 
 func New(s string) *Parser {
@@ -19,74 +29,142 @@ func New(s string) *Parser {
 	p := &Parser{
 		doc:  []rune(s),
 		meta: make(map[string]string),
+		ids:  make(map[string]int),
 	}
 	p.read()
 	return p
 }
 
+// Pos returns the offset, in runes, of the parser in the document.
+func (p *Parser) Pos() int {
+	return p.pos
+}
+
+// LineColumn returns the line and column, counting from 1, of the first
+// rune at or after offset that is not white space, which is where a node
+// read from offset starts.
+func (p *Parser) LineColumn(offset int) (line, column int) {
+	for offset < len(p.doc) && unicode.IsSpace(p.doc[offset]) {
+		offset++
+	}
+	line, column = 1, 1
+	for _, c := range p.doc[:offset] {
+		if c == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+// Next returns the next top level node, or nil at the end of the document.
 func (p *Parser) Next() ast.Node {
+	start := p.pos
+	node := p.next()
+	p.checkMath(start, node)
+	return node
+}
+
+func (p *Parser) next() ast.Node {
+	if p.ch == 0 {
+		return nil
+	}
+	if node, ok := p.extension(true); ok {
+		return node
+	}
+	if node, ok := p.builtin(); ok {
+		return node
+	}
+	if node, ok := p.extension(false); ok {
+		return node
+	}
+	switch p.ch {
+	case '"', '|', ':', '$', '@', '[', '#', '{', '=', '-', '`', '!', 'i', 'v':
+		return p.readPlainText(true)
+	default:
+		return p.readPlainText(false)
+	}
+}
+
+// builtin parses the block at the current position if it is one of the
+// kinds built into typeup.
+func (p *Parser) builtin() (ast.Node, bool) {
 	switch p.ch {
 	case '"':
 		if node, ok := p.multilineQuoteAhead(); ok {
-			return node
+			return node, true
+		}
+	case '|':
+		if node, ok := p.blockQuoteAhead(); ok {
+			return node, true
+		}
+	case ':':
+		if node, ok := p.calloutAhead(); ok {
+			return node, true
+		}
+	case '$':
+		if node, ok := p.mathAhead(); ok {
+			return node, true
 		}
-		return p.readPlainText(true)
 	case '@':
 		if p.metaAhead() {
-			return p.Next()
+			return p.next(), true
+		}
+		if node, ok := p.labelAhead(); ok {
+			return node, true
 		}
-		return p.readPlainText(true)
 	case '[':
+		if node, ok := p.linkDefAhead(); ok {
+			return node, true
+		}
 		if node, ok := p.ulAhead(); ok {
-			return node
+			return node, true
 		}
-		return p.readPlainText(true)
 	case '#':
 		if node, ok := p.headingAhead(); ok {
-			return node
+			return node, true
 		}
 		if node, ok := p.tableAhead(); ok {
-			return node
+			return node, true
 		}
-		return p.readPlainText(true)
 	case '{':
 		if node, ok := p.olAhead(); ok {
-			return node
+			return node, true
 		}
-		return p.readPlainText(true)
 	case '=':
 		if node, ok := p.headingShortAhead(); ok {
-			return node
+			return node, true
 		}
 		if node, ok := p.codeAhead(p.ch); ok {
-			return node
+			return node, true
 		}
-		return p.readPlainText(true)
 	case '-':
 		if node, ok := p.themeBreakAhead(); ok {
-			return node
+			return node, true
 		}
-		return p.readPlainText(true)
 	case '`':
 		if node, ok := p.codeAhead(p.ch); ok {
-			return node
+			return node, true
 		}
-		return p.readPlainText(true)
 	case '!':
 		if node, ok := p.imageShortAhead(); ok {
-			return node
+			return node, true
 		}
-		return p.readPlainText(true)
 	case 'i':
-		if p.ignoreAhead() {
-			return p.Next()
+		if node, ok := p.imageAhead(); ok {
+			return node, true
+		}
+		if node, ok := p.ignoreAhead(); ok {
+			return node, true
+		}
+	case 'v':
+		if node, ok := p.videoAhead(); ok {
+			return node, true
 		}
-		return p.readPlainText(true)
-	case 0:
-		return nil
-	default:
-		return p.readPlainText(false)
 	}
+	return nil, false
 }
 
 func (p *Parser) codeAhead(delim rune) (*ast.Code, bool) {
@@ -148,6 +226,10 @@ func (p *Parser) linkAhead() (*ast.Anchor, bool) {
 		p.setPos(backupPos)
 		return nil, false
 	}
+	if label, end := p.refLabel(p.doc, p.pos); end > 0 {
+		p.SetPos(end + 1)
+		return p.refAnchor(text, label), true
+	}
 	if strings.Contains(text, "|") {
 		var t, href string
 		for i := len(text) - 1; i >= 0; i-- {
@@ -166,7 +248,7 @@ func (p *Parser) linkAhead() (*ast.Anchor, bool) {
 			}
 			if href != "" {
 				return &ast.Anchor{
-					Text: processText(t),
+					Text: p.processText(t),
 					URL:  href,
 				}, true
 			}
@@ -185,12 +267,150 @@ func (p *Parser) linkAhead() (*ast.Anchor, bool) {
 	default:
 		text = strings.Join(fields[:len(fields)-1], " ")
 		return &ast.Anchor{
-			Text: processText(text),
+			Text: p.processText(text),
 			URL:  fields[len(fields)-1],
 		}, true
 	}
 }
 
+var linkDefRe = regexp.MustCompile(`^\[([^\]]*[^\]\s][^\]]*)\]:[ \t]+(\S+)(?:[ \t]+"([^"]*)")?[ \t]*$`)
+
+// lineEnd returns the offset of the end of the current line.
+func (p *Parser) lineEnd() int {
+	end := p.pos
+	for end < len(p.doc) && p.doc[end] != '\n' {
+		end++
+	}
+	return end
+}
+
+func (p *Parser) isLinkDef() bool {
+	return p.ch == '[' && p.isStartOfLine() && linkDefRe.MatchString(string(p.doc[p.pos:p.lineEnd()]))
+}
+
+// linkDefAhead parses the definition of a reference link label,
+// `[label]: url "title"` with the title optional.
+func (p *Parser) linkDefAhead() (*ast.LinkDef, bool) {
+	if p.ch != '[' || !p.isStartOfLine() {
+		return nil, false
+	}
+	end := p.lineEnd()
+	m := linkDefRe.FindStringSubmatch(string(p.doc[p.pos:end]))
+	if m == nil {
+		return nil, false
+	}
+	p.SetPos(end + 1)
+	return &ast.LinkDef{
+		Label: strings.TrimSpace(m[1]),
+		URL:   m[2],
+		Title: m[3],
+	}, true
+}
+
+// refLabel returns the label of a reference link in s[i:], "[label]"
+// following the text of the link, and the index of its closing bracket.
+// An empty label, "[]", stands for the text. end is -1 if there is none.
+// Brackets holding a URL are a link of their own, as in
+// "[docs a.html][guide b.html]", unless the label is defined.
+func (p *Parser) refLabel(s []rune, i int) (label string, end int) {
+	if i >= len(s) || s[i] != '[' {
+		return "", -1
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\n', '[':
+			return "", -1
+		case ']':
+			label = strings.TrimSpace(string(s[i+1 : j]))
+			if fields := strings.Fields(label); len(fields) > 0 && urlLike.MatchString(fields[len(fields)-1]) && !p.defined(label) {
+				return "", -1
+			}
+			return label, j
+		}
+	}
+	return "", -1
+}
+
+// defined reports whether label is defined anywhere in the document.
+func (p *Parser) defined(label string) bool {
+	if p.labels == nil {
+		p.labels = make(map[string]bool)
+		for _, ln := range strings.Split(string(p.doc), "\n") {
+			if m := linkDefRe.FindStringSubmatch(ln); m != nil {
+				p.labels[ast.NormalizeLabel(m[1])] = true
+			}
+		}
+	}
+	return p.labels[ast.NormalizeLabel(label)]
+}
+
+var urlLike = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:|[/#]|\.[a-zA-Z][a-zA-Z0-9]{1,4}$`)
+
+// refAnchor returns a reference link with the given text and label.
+func (p *Parser) refAnchor(text, label string) *ast.Anchor {
+	if label == "" {
+		label = text
+	}
+	return &ast.Anchor{Text: p.processText(text), Ref: label}
+}
+
+// refAhead parses a cross reference, "[@label]".
+func (p *Parser) refAhead() (*ast.Ref, bool) {
+	ref, end := hasRef(p.doc, p.pos)
+	if end < 0 {
+		return nil, false
+	}
+	p.SetPos(end + 1)
+	return ref, true
+}
+
+// labelAhead parses "@label{name}" on a line of its own and the block
+// after it, which gets the label.
+func (p *Parser) labelAhead() (ast.Node, bool) {
+	if !p.isStartOfLine() || !p.aheadIs("@label{") {
+		return nil, false
+	}
+	backupPos := p.pos
+	end := p.lineEnd()
+	line := strings.TrimSpace(string(p.doc[p.pos:end]))
+	label := strings.TrimSuffix(strings.TrimPrefix(line, "@label{"), "}")
+	if !strings.HasSuffix(line, "}") || label == "" || strings.ContainsAny(label, " \t{}") {
+		return nil, false
+	}
+	p.SetPos(end + 1)
+	var node ast.Node
+	for {
+		// Inside a block list item, the closing ')' is not read by
+		// next; stop there instead of parsing nothing forever.
+		if p.ch == 0 || p.items > 0 && p.lineOnlyCharIs(')') {
+			p.warnAt(backupPos, "label %q is not followed by a labellable block", label)
+			return &ast.TextBlock{}, true
+		}
+		pos := p.pos
+		node = p.next()
+		if !isEmptyNode(node) {
+			break
+		}
+		if p.pos == pos {
+			p.warnAt(backupPos, "label %q is not followed by a labellable block", label)
+			return &ast.TextBlock{}, true
+		}
+	}
+	switch n := node.(type) {
+	case *ast.Heading:
+		n.Label = label
+	case *ast.Table:
+		n.Label = label
+	case *ast.Image:
+		n.Label = label
+	case *ast.Code:
+		n.Label = label
+	default:
+		p.warnAt(backupPos, "label %q must be followed by a heading, table, image or code block", label)
+	}
+	return node, true
+}
+
 func (p *Parser) headingAhead() (head *ast.Heading, yes bool) {
 	if p.ch != '#' || !p.isStartOfLine() {
 		return
@@ -199,6 +419,7 @@ func (p *Parser) headingAhead() (head *ast.Heading, yes bool) {
 		char       rune
 		idx, level int
 		buff       strings.Builder
+		unnumbered bool
 	)
 	for i := p.pos; i < len(p.doc); i++ {
 		char = p.doc[i]
@@ -211,13 +432,17 @@ func (p *Parser) headingAhead() (head *ast.Heading, yes bool) {
 		}
 		if char != '#' {
 			idx = i + 1 // set the cursor to the text
+			// "#*" leaves the heading unnumbered
+			if unnumbered = char == '*'; unnumbered && idx < len(p.doc) && p.doc[idx] == ' ' {
+				idx++
+			}
 			break
 		}
 
 		level++
 	}
 
-	if idx >= len(p.doc) {
+	if idx == 0 || idx >= len(p.doc) {
 		p.warnAt(idx, "line doesn't make sense")
 		return
 	}
@@ -238,15 +463,20 @@ func (p *Parser) headingAhead() (head *ast.Heading, yes bool) {
 			return
 		}
 		if char == '\n' {
-			p.setPos(i)
 			break
 		}
 		buff.WriteRune(char)
 	}
+	for p.ch != '\n' && p.ch != 0 {
+		p.read()
+	}
 
+	title := p.processText(buff.String())
 	return &ast.Heading{
-		Level: level,
-		Title: processText(buff.String()),
+		Level:      level,
+		Title:      title,
+		ID:         p.headingID(title.Bare()),
+		Unnumbered: unnumbered,
 	}, true
 }
 
@@ -328,7 +558,7 @@ LOOP:
 		return nil, false
 	}
 
-	return parseTable(rows, delim), true
+	return p.parseTable(rows, delim), true
 }
 
 func (p *Parser) ulAhead() (*ast.UnorderedList, bool) {
@@ -352,20 +582,20 @@ func (p *Parser) ulAhead() (*ast.UnorderedList, bool) {
 	var (
 		ln    string
 		buff  strings.Builder
-		items []ast.ListItem
+		items []*ast.ListItem
 	)
 LOOP:
 	for {
 		switch p.ch {
 		case '[':
 			if item, ok := p.ulAhead(); ok {
-				items = append(items, item)
+				items = append(items, &ast.ListItem{Blocks: []ast.Node{item}})
 			} else {
 				buff.WriteRune(p.ch)
 			}
 		case '{':
 			if item, ok := p.olAhead(); ok {
-				items = append(items, item)
+				items = append(items, &ast.ListItem{Blocks: []ast.Node{item}})
 			} else {
 				buff.WriteRune(p.ch)
 			}
@@ -379,11 +609,24 @@ LOOP:
 			p.warnAt(p.pos, "possible list not terminated with ']'")
 			p.setPos(backupPos)
 			return nil, false
+		case '(':
+			if item, ok := p.blockItemAhead(); ok {
+				items = append(items, item)
+				buff.Reset()
+			} else {
+				buff.WriteRune(p.ch)
+			}
 		case '\n':
 			ln = buff.String()
 			buff.Reset()
-			if !isEmpty(ln) {
-				items = append(items, processText(ln))
+			if trimmed := strings.TrimRight(ln, " \t"); strings.HasSuffix(trimmed, "\\") {
+				// the item continues on the next line
+				buff.WriteString(strings.TrimSuffix(trimmed, "\\"))
+				buff.WriteRune('\n')
+			} else if !isEmpty(ln) {
+				items = append(items, &ast.ListItem{
+					Blocks: []ast.Node{p.processText(ln)},
+				})
 			}
 		default:
 			buff.WriteRune(p.ch)
@@ -416,20 +659,20 @@ func (p *Parser) olAhead() (*ast.OrderedList, bool) {
 	var (
 		ln    string
 		buff  strings.Builder
-		items []ast.ListItem
+		items []*ast.ListItem
 	)
 LOOP:
 	for {
 		switch p.ch {
 		case '[':
 			if item, ok := p.ulAhead(); ok {
-				items = append(items, item)
+				items = append(items, &ast.ListItem{Blocks: []ast.Node{item}})
 			} else {
 				buff.WriteRune(p.ch)
 			}
 		case '{':
 			if item, ok := p.olAhead(); ok {
-				items = append(items, item)
+				items = append(items, &ast.ListItem{Blocks: []ast.Node{item}})
 			} else {
 				buff.WriteRune(p.ch)
 			}
@@ -443,11 +686,24 @@ LOOP:
 			p.warnAt(p.pos, "possible list not terminated with '}'")
 			p.setPos(backupPos)
 			return nil, false
+		case '(':
+			if item, ok := p.blockItemAhead(); ok {
+				items = append(items, item)
+				buff.Reset()
+			} else {
+				buff.WriteRune(p.ch)
+			}
 		case '\n':
 			ln = buff.String()
 			buff.Reset()
-			if !isEmpty(ln) {
-				items = append(items, processText(ln))
+			if trimmed := strings.TrimRight(ln, " \t"); strings.HasSuffix(trimmed, "\\") {
+				// the item continues on the next line
+				buff.WriteString(strings.TrimSuffix(trimmed, "\\"))
+				buff.WriteRune('\n')
+			} else if !isEmpty(ln) {
+				items = append(items, &ast.ListItem{
+					Blocks: []ast.Node{p.processText(ln)},
+				})
 			}
 		default:
 			buff.WriteRune(p.ch)
@@ -459,111 +715,119 @@ LOOP:
 	}, true
 }
 
-func processText(source string) ast.TextNode {
+// blockItemAhead parses a list item that holds blocks, written between
+// lines containing only '(' and ')'.
+func (p *Parser) blockItemAhead() (*ast.ListItem, bool) {
+	if p.ch != '(' || !p.lineOnlyCharIs('(') {
+		return nil, false
+	}
+	backupPos := p.pos
+	for p.ch != 0 && p.ch != '\n' {
+		p.read()
+	}
+	if p.ch == 0 {
+		p.warnAt(backupPos, "stray '('")
+		p.setPos(backupPos)
+		return nil, false
+	}
+	p.read()
+	p.items++
+	defer func() { p.items-- }()
+	restore := p.snapshot()
+	var blocks []ast.Node
+	for {
+		if p.ch == 0 {
+			restore()
+			p.warnAt(p.pos, "possible list item not terminated with ')'")
+			p.setPos(backupPos)
+			return nil, false
+		}
+		if p.lineOnlyCharIs(')') {
+			for p.ch != ')' {
+				p.read()
+			}
+			p.read()
+			break
+		}
+		if node := p.next(); !isEmptyNode(node) {
+			blocks = append(blocks, node)
+		}
+	}
+	return &ast.ListItem{Blocks: blocks}, true
+}
+
+// parseRange parses the blocks in doc[start:end].
+func (p *Parser) parseRange(start, end int) []ast.Node {
+	sub := &Parser{
+		doc:     p.doc[:end],
+		meta:    p.meta,
+		ids:     p.ids,
+		exts:    p.exts,
+		inlines: p.inlines,
+	}
+	if start >= end {
+		return nil
+	}
+	sub.setPos(start)
+	var blocks []ast.Node
+	for node := sub.next(); node != nil; node = sub.next() {
+		if !isEmptyNode(node) {
+			blocks = append(blocks, node)
+		}
+	}
+	p.warnings = append(p.warnings, sub.warnings...)
+	if sub.far > p.far {
+		p.far = sub.far
+	}
+	return blocks
+}
+
+// parseText parses s as the blocks of a text nested in the document,
+// such as the contents of a quote. Warnings are reported at pos.
+func (p *Parser) parseText(s string, pos int) []ast.Node {
+	sub := New(s)
+	sub.meta, sub.ids = p.meta, p.ids
+	sub.exts, sub.inlines = p.exts, p.inlines
+	var blocks []ast.Node
+	for node := sub.next(); node != nil; node = sub.next() {
+		if !isEmptyNode(node) {
+			blocks = append(blocks, node)
+		}
+	}
+	for _, w := range sub.warnings {
+		w.doc, w.pos = p.doc, pos
+	}
+	p.warnings = append(p.warnings, sub.warnings...)
+	return blocks
+}
+
+func (p *Parser) processText(source string) *ast.TextBlock {
 	var (
 		s     = []rune(source)
 		buff  strings.Builder
-		ch    rune
 		items []ast.TextNode
 		text  string
 	)
 
-LOOP:
 	for i := 0; i < len(s); i++ {
-		ch = s[i]
-		switch ch {
-		case '`', '\'':
-			if code, pos := hasInlineCode(s, i); pos > i {
-				text = strings.TrimSpace(buff.String())
-				buff.Reset()
-				if text != "" {
-					items = append(items, &ast.Text{Text: text})
-				}
-				items = append(items, code)
-				i = pos
-			} else {
-				buff.WriteRune(ch)
-			}
-		case '/':
-			if (i > 0 && s[i-1] != ':' || i == 0) && (i+1 < len(s) && s[i+1] == ch || i+1 >= len(s)) {
-				if italic, pos := hasItalicLong(s, i); pos > i {
-					text = strings.TrimSpace(buff.String())
-					buff.Reset()
-					if text != "" {
-						items = append(items, &ast.Text{Text: text})
-					}
-					items = append(items, italic)
-					i = pos
-				} else {
-					buff.WriteRune(ch)
-				}
-			} else {
-				buff.WriteRune(ch)
-			}
-		case '=':
-			if (i > 0 && unicode.IsSpace(s[i-1]) || i == 0) && (i+1 < len(s) && s[i+1] == ch || i+1 >= len(s)) {
-				if bold, pos := hasBoldLong(s, i); pos > i {
-					text = strings.TrimSpace(buff.String())
-					buff.Reset()
-					if text != "" {
-						items = append(items, &ast.Text{Text: text})
-					}
-					items = append(items, bold)
-					i = pos
-				} else {
-					buff.WriteRune(ch)
-				}
-			} else {
-				buff.WriteRune(ch)
-			}
-		case '[':
-			if anchor, pos := hasAnchor(s, i); pos > i {
-				text = strings.TrimSpace(buff.String())
-				if text != "" {
-					items = append(items, &ast.Text{
-						Text: text,
-					})
-				}
-				buff.Reset()
-				items = append(items, anchor)
-				i = pos
-				continue LOOP
-			} else {
-				buff.WriteRune(ch)
-			}
-		case '*':
-			if item, pos := hasItalic(s, i); pos > i {
-				text = strings.TrimSpace(buff.String())
-				if text != "" {
-					items = append(items, &ast.Text{
-						Text: text,
-					})
-				}
-				buff.Reset()
-				items = append(items, item)
-				i = pos
-				continue LOOP // maybe remove
-			} else {
-				buff.WriteRune(ch)
-			}
-		case '_':
-			if item, pos := hasBold(s, i); pos > i {
-				text = strings.TrimSpace(buff.String())
-				if text != "" {
-					items = append(items, &ast.Text{
-						Text: text,
-					})
-				}
-				buff.Reset()
-				items = append(items, item)
-				i = pos
-				continue LOOP
-			} else {
-				buff.WriteRune(ch)
-			}
-		default:
-			buff.WriteRune(ch)
+		node, pos := p.inlineExtension(s, i, true)
+		if pos <= i {
+			node, pos = p.builtinInline(s, i)
 		}
+		if pos <= i {
+			node, pos = p.inlineExtension(s, i, false)
+		}
+		if pos <= i {
+			buff.WriteRune(s[i])
+			continue
+		}
+		text = strings.TrimSpace(buff.String())
+		buff.Reset()
+		if text != "" {
+			items = append(items, &ast.Text{Text: text})
+		}
+		items = append(items, node)
+		i = pos
 	}
 	text = strings.TrimSpace(buff.String())
 	if text != "" {
@@ -576,7 +840,37 @@ LOOP:
 	}
 }
 
-func parseTable(lines []string, delim string) *ast.Table {
+// builtinInline parses the text element built into typeup at s[i], if
+// any, returning it and the index of its last rune.
+func (p *Parser) builtinInline(s []rune, i int) (ast.TextNode, int) {
+	ch := s[i]
+	switch ch {
+	case '`', '\'':
+		return hasInlineCode(s, i)
+	case '$':
+		return hasMath(s, i)
+	case '/':
+		if (i > 0 && s[i-1] != ':' || i == 0) && (i+1 < len(s) && s[i+1] == ch || i+1 >= len(s)) {
+			return hasItalicLong(s, i)
+		}
+	case '=':
+		if (i > 0 && unicode.IsSpace(s[i-1]) || i == 0) && (i+1 < len(s) && s[i+1] == ch || i+1 >= len(s)) {
+			return hasBoldLong(s, i)
+		}
+	case '[':
+		if ref, pos := hasRef(s, i); pos > i {
+			return ref, pos
+		}
+		return p.hasAnchor(s, i)
+	case '*':
+		return hasItalic(s, i)
+	case '_':
+		return hasBold(s, i)
+	}
+	return nil, -1
+}
+
+func (p *Parser) parseTable(lines []string, delim string) *ast.Table {
 	headers := strings.Split(lines[0], delim)
 	var rows [][]string
 	for _, row := range lines[1:] {
@@ -586,12 +880,12 @@ func parseTable(lines []string, delim string) *ast.Table {
 	var table ast.Table
 	for _, x := range headers {
 		table.Headers = append(table.Headers,
-			processText(x))
+			p.processText(x))
 	}
 	for _, row := range rows {
 		var cells []ast.TextNode
 		for _, x := range row {
-			cells = append(cells, processText(x))
+			cells = append(cells, p.processText(x))
 		}
 		table.Rows = append(table.Rows, cells)
 	}
@@ -634,11 +928,13 @@ LOOP:
 		p.setPos(backupPos)
 		return nil, false
 	}
-	node := processText(text)
+	node := p.processText(text)
 	p.meta["title"] = node.Bare()
 	return &ast.Heading{
-		Level: 1,
-		Title: node,
+		Level:   1,
+		Title:   node,
+		ID:      p.headingID(node.Bare()),
+		IsTitle: true,
 	}, true
 }
 
@@ -652,6 +948,13 @@ func (p *Parser) readPlainText(force bool) *ast.TextBlock {
 
 LOOP:
 	for {
+		if p.pos != backupPos && p.isStartOfLine() && p.triggered() {
+			text = strings.TrimSpace(buff.String())
+			if text != "" {
+				items = append(items, p.processText(text))
+			}
+			break LOOP
+		}
 		switch p.ch {
 		case '"':
 			if force && p.pos == backupPos {
@@ -659,7 +962,7 @@ LOOP:
 			} else if p.isStartOfLine() && p.aheadIs(`"""`) {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
@@ -668,10 +971,10 @@ LOOP:
 		case '@':
 			if p.pos == backupPos && force {
 				buff.WriteRune(p.ch)
-			} else if p.isStartOfLine() && p.peek() == '{' {
+			} else if p.isStartOfLine() && (p.peek() == '{' || p.aheadIs("@label{")) {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
@@ -683,7 +986,7 @@ LOOP:
 			} else if p.peek() == p.ch && p.peekN(2) == p.ch && p.isStartOfLine() {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
@@ -695,7 +998,7 @@ LOOP:
 			} else if p.isStartOfLine() && (p.aheadIs("image[") || p.aheadIs("ignore{")) {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
@@ -707,7 +1010,7 @@ LOOP:
 			} else if p.isStartOfLine() && p.peek() == '[' {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
@@ -719,7 +1022,7 @@ LOOP:
 			} else if p.isStartOfLine() && p.aheadIs("video[") {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
@@ -731,17 +1034,30 @@ LOOP:
 			} else if p.isStartOfLine() && p.peek() == '-' && p.peekN(2) == '-' {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
 				buff.WriteRune(p.ch)
 			}
 		case '[':
-			node, ok := p.linkAhead()
+			if p.pos != backupPos && p.isStartOfLine() && p.isLinkDef() {
+				text = strings.TrimSpace(buff.String())
+				if text != "" {
+					items = append(items, p.processText(text))
+				}
+				break LOOP
+			}
+			var node ast.TextNode
+			ref, ok := p.refAhead()
+			if ok {
+				node = ref
+			} else {
+				node, ok = p.linkAhead()
+			}
 			text = strings.TrimSpace(buff.String())
 			if text != "" {
-				items = append(items, processText(text))
+				items = append(items, p.processText(text))
 			}
 			buff.Reset()
 			if ok {
@@ -758,7 +1074,7 @@ LOOP:
 			} else if p.isStartOfLine() {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
@@ -770,33 +1086,67 @@ LOOP:
 			} else if p.isStartOfLine() && p.peek() == '#' {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else if p.isStartOfLine() && p.peek() == '=' && p.peekN(2) == '=' {
 				text = strings.TrimSpace(buff.String())
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
 				break LOOP
 			} else {
 				buff.WriteRune(p.ch)
 			}
 		case '|':
-			if node, ok := p.blockQuoteAhead(); ok {
+			if force && p.pos == backupPos {
+				buff.WriteRune(p.ch)
+			} else if p.isStartOfLine() && p.peek() != '\n' && p.peek() != 0 {
 				text = strings.TrimSpace(buff.String())
-				buff.Reset()
 				if text != "" {
-					items = append(items, processText(text))
+					items = append(items, p.processText(text))
 				}
-				items = append(items, node)
+				break LOOP
 			} else {
 				buff.WriteRune(p.ch)
 			}
+		case '$':
+			if force && p.pos == backupPos {
+				buff.WriteRune(p.ch)
+			} else if p.isStartOfLine() && p.aheadIs("$$") {
+				text = strings.TrimSpace(buff.String())
+				if text != "" {
+					items = append(items, p.processText(text))
+				}
+				break LOOP
+			} else {
+				buff.WriteRune(p.ch)
+			}
+		case ':':
+			if force && p.pos == backupPos {
+				buff.WriteRune(p.ch)
+			} else if p.isStartOfLine() && p.aheadIs(":::") {
+				text = strings.TrimSpace(buff.String())
+				if text != "" {
+					items = append(items, p.processText(text))
+				}
+				break LOOP
+			} else {
+				buff.WriteRune(p.ch)
+			}
+		case ')':
+			if p.items > 0 && p.lineOnlyCharIs(p.ch) {
+				text = strings.TrimSpace(buff.String())
+				if text != "" {
+					items = append(items, p.processText(text))
+				}
+				break LOOP
+			}
+			buff.WriteRune(p.ch)
 		case 0:
 			text = strings.TrimSpace(buff.String())
 			if text != "" {
-				items = append(items, processText(text))
+				items = append(items, p.processText(text))
 			}
 			break LOOP
 		default:
@@ -867,7 +1217,7 @@ func (p *Parser) imageAhead() (*ast.Image, bool) {
 		var alt, href string
 		for i := len(text) - 1; i >= 0; i-- {
 			if text[i] == '|' {
-				text = strings.TrimSpace(text[:i])
+				alt = strings.TrimSpace(text[:i])
 				href = strings.TrimSpace(text[i+1:])
 				break
 			}
@@ -987,9 +1337,11 @@ func (p *Parser) imageShortAhead() (img *ast.Image, yes bool) {
 	}
 }
 
-func (p *Parser) ignoreAhead() bool {
+// ignoreAhead parses an ignore block, whose lines between "ignore{" and
+// a line containing only '}' are not rendered.
+func (p *Parser) ignoreAhead() (*ast.Ignore, bool) {
 	if !p.isStartOfLine() || !p.aheadIs("ignore") {
-		return false
+		return nil, false
 	}
 	backupPos := p.pos
 	for range "ignore" {
@@ -998,11 +1350,11 @@ func (p *Parser) ignoreAhead() bool {
 	for p.ch != '{' {
 		if p.ch == '\n' || p.ch == 0 {
 			p.setPos(backupPos)
-			return false
+			return nil, false
 		}
 		if !unicode.IsSpace(p.ch) {
 			p.setPos(backupPos)
-			return false
+			return nil, false
 		}
 		p.read()
 	}
@@ -1010,26 +1362,31 @@ func (p *Parser) ignoreAhead() bool {
 	for {
 		if p.ch == 0 {
 			p.setPos(backupPos)
-			return false
+			return nil, false
 		}
 		if p.ch == '\n' {
 			break
 		}
 		if !unicode.IsSpace(p.ch) {
 			p.setPos(backupPos)
-			return false
+			return nil, false
 		}
 		p.read()
 	}
 
+	start := p.pos + 1
 	for {
 		if p.ch == '}' && p.lineOnlyCharIs('}') {
+			end := p.pos
+			for end > start && p.doc[end-1] != '\n' {
+				end--
+			}
 			p.read()
-			return true
+			return &ast.Ignore{Text: strings.TrimSuffix(string(p.doc[start:end]), "\n")}, true
 		}
 		if p.ch == 0 {
 			p.setPos(backupPos)
-			return false
+			return nil, false
 		}
 		p.read()
 	}
@@ -1144,39 +1501,67 @@ func (p *Parser) blockQuoteAhead() (*ast.BlockQuote, bool) {
 	if p.ch != '|' || !p.isStartOfLine() {
 		return nil, false
 	}
-	if p.peek() == '\n' {
+	if p.peek() == '\n' || p.peek() == 0 {
 		return nil, false
 	}
 	var (
-		buff      strings.Builder
+		lines     []string
 		backupPos = p.pos
 	)
-	p.read()
 	for {
-		if p.ch == 0 {
-			break
-		}
-		if p.ch == '\n' {
-			if p.peek() != '|' {
-				break
-			}
-			buff.WriteRune(p.ch)
-			p.read()
+		// strip one level of '|' and the space after it
+		p.read()
+		if p.ch == ' ' {
 			p.read()
-			continue
 		}
-		buff.WriteRune(p.ch)
+		lines = append(lines, p.readLineRest())
+		if p.ch == 0 || p.peek() != '|' {
+			break
+		}
 		p.read()
 	}
-	text := strings.TrimSpace(buff.String())
-	if text == "" {
+	if isEmpty(strings.Join(lines, "")) {
 		p.setPos(backupPos)
 		p.warnAt(p.pos, "empty block quote")
 		return nil, false
 	}
-	return &ast.BlockQuote{
-		Text: processText(text),
-	}, true
+	bq := &ast.BlockQuote{}
+	if attr, ok := p.attribution(lines[len(lines)-1]); ok {
+		lines = lines[:len(lines)-1]
+		bq.Attribution, bq.Cite = attr, citeURL(attr)
+	}
+	bq.Blocks = p.parseText(strings.Join(lines, "\n"), backupPos)
+	return bq, true
+}
+
+// attribution returns the text of a quote attribution line,
+// written as "-- Author".
+func (p *Parser) attribution(line string) (*ast.TextBlock, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "-- ") {
+		return nil, false
+	}
+	return p.processText(strings.TrimSpace(line[3:])), true
+}
+
+// citeURL removes and returns a trailing URL from a quote attribution.
+func citeURL(attr *ast.TextBlock) string {
+	if len(attr.Items) == 0 {
+		return ""
+	}
+	t, ok := attr.Items[len(attr.Items)-1].(*ast.Text)
+	if !ok || t.Style != ast.NoStyle {
+		return ""
+	}
+	fields := strings.Fields(t.Text)
+	if len(fields) == 0 || !strings.Contains(fields[len(fields)-1], "://") {
+		return ""
+	}
+	t.Text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(t.Text), fields[len(fields)-1]))
+	if t.Text == "" {
+		attr.Items = attr.Items[:len(attr.Items)-1]
+	}
+	return fields[len(fields)-1]
 }
 
 func (p *Parser) multilineQuoteAhead() (*ast.BlockQuote, bool) {
@@ -1196,8 +1581,10 @@ func (p *Parser) multilineQuoteAhead() (*ast.BlockQuote, bool) {
 		return nil, false
 	}
 	p.read()
+	start, end := p.pos, p.pos
 	for {
 		if p.ch == '"' && p.isStartOfLine() && p.aheadIs(`"""`) {
+			end = p.pos
 			p.read()
 			p.read()
 			p.read()
@@ -1216,13 +1603,146 @@ func (p *Parser) multilineQuoteAhead() (*ast.BlockQuote, bool) {
 		p.read()
 	}
 
-	text := strings.TrimSpace(buff.String())
-	if text == "" {
+	if isEmpty(buff.String()) {
 		p.setPos(backupPos)
 		p.warnAt(p.pos, "multiline block quote is empty")
 		return nil, false
 	}
-	return &ast.BlockQuote{
-		Text: processText(text),
-	}, true
+	bq := &ast.BlockQuote{}
+	// the last line may be an attribution
+	text := strings.TrimRight(string(p.doc[start:end]), " \t\n")
+	i := strings.LastIndexByte(text, '\n')
+	if attr, ok := p.attribution(text[i+1:]); ok {
+		bq.Attribution, bq.Cite = attr, citeURL(attr)
+		end = start + len([]rune(text[:i+1]))
+	}
+	bq.Blocks = p.parseRange(start, end)
+	return bq, true
+}
+
+var calloutKinds = map[string]bool{
+	"note":      true,
+	"tip":       true,
+	"info":      true,
+	"important": true,
+	"warning":   true,
+	"caution":   true,
+	"danger":    true,
+}
+
+// calloutAhead parses a callout, opened by a line ':::kind optional title'
+// and closed by a line containing only ':::'.
+func (p *Parser) calloutAhead() (*ast.Callout, bool) {
+	if !p.isStartOfLine() || !p.aheadIs(":::") {
+		return nil, false
+	}
+	backupPos := p.pos
+	for range ":::" {
+		p.read()
+	}
+	line := strings.TrimSpace(p.readLineRest())
+	i := strings.IndexFunc(line, unicode.IsSpace)
+	if i < 0 {
+		i = len(line)
+	}
+	kind := strings.ToLower(line[:i])
+	if kind == "" || strings.IndexFunc(kind, func(r rune) bool {
+		return r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) >= 0 {
+		p.warnAt(backupPos, "stray ':::'")
+		p.setPos(backupPos)
+		return nil, false
+	}
+	restore := p.snapshot()
+	if !calloutKinds[kind] {
+		p.warnAt(backupPos+3, "unknown callout kind %q", kind)
+	}
+	c := &ast.Callout{Kind: kind}
+	if title := strings.TrimSpace(line[i:]); title != "" {
+		c.Title = p.processText(title)
+	}
+	p.read()
+	for {
+		// a ')' line closes the enclosing list item first
+		if p.ch == 0 || p.items > 0 && p.lineOnlyCharIs(')') {
+			restore()
+			p.warnAt(backupPos, "callout not terminated with ':::'")
+			p.setPos(backupPos)
+			return nil, false
+		}
+		if p.calloutEndAhead() {
+			p.readLineRest()
+			break
+		}
+		if node := p.next(); !isEmptyNode(node) {
+			c.Blocks = append(c.Blocks, node)
+		}
+	}
+	return c, true
+}
+
+func (p *Parser) calloutEndAhead() bool {
+	return p.isStartOfLine() && p.aheadIs(":::") && isSpaceUntilLF(p.doc, p.pos+3)
+}
+
+// mathAhead parses display math, either between lines containing only
+// '$$' or on a single line as '$$ tex $$'.
+func (p *Parser) mathAhead() (*ast.Math, bool) {
+	if !p.isStartOfLine() || !p.aheadIs("$$") {
+		return nil, false
+	}
+	backupPos := p.pos
+	line := strings.TrimSpace(p.readLineRest())
+	if line != "$$" {
+		if tex := strings.TrimSpace(strings.TrimPrefix(line, "$$")); len(tex) > 2 && strings.HasSuffix(tex, "$$") {
+			return &ast.Math{TeX: strings.TrimSpace(tex[:len(tex)-2]), Display: true}, true
+		}
+		p.setPos(backupPos)
+		return nil, false
+	}
+	p.read()
+	start := p.pos
+	for {
+		if p.ch == 0 {
+			p.warnAt(backupPos, "display math not terminated with '$$'")
+			p.setPos(backupPos)
+			return nil, false
+		}
+		if p.isStartOfLine() && p.aheadIs("$$") && isSpaceUntilLF(p.doc, p.pos+2) {
+			break
+		}
+		p.readLineRest()
+		p.read()
+	}
+	tex := strings.TrimSpace(string(p.doc[start:p.pos]))
+	if tex == "" {
+		p.warnAt(backupPos, "display math is empty")
+		p.setPos(backupPos)
+		return nil, false
+	}
+	p.readLineRest()
+	return &ast.Math{TeX: tex, Display: true}, true
+}
+
+// checkMath reports the math in node, parsed from the document starting
+// at start, that can not be converted to MathML.
+func (p *Parser) checkMath(start int, node ast.Node) {
+	if node == nil {
+		return
+	}
+	src := string(p.doc[start:p.pos])
+	ast.Inspect(node, func(n interface{}) bool {
+		m, ok := n.(*ast.Math)
+		if !ok {
+			return true
+		}
+		if _, err := mathml.Convert(m.TeX, m.Display); err != nil {
+			pos := start
+			if i := strings.Index(src, m.TeX); i >= 0 {
+				pos += utf8.RuneCountInString(src[:i])
+			}
+			p.warnAt(pos, "math: %s", err)
+		}
+		return true
+	})
 }
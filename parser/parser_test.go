@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLabelAtEndOfBlockItem(t *testing.T) {
+	done := make(chan *Parser)
+	go func() {
+		p := New("[\n(\npara\n@label{l}\n)\n]\n")
+		for p.Next() != nil {
+		}
+		done <- p
+	}()
+	select {
+	case p := <-done:
+		var found bool
+		for _, w := range p.Warnings() {
+			if strings.Contains(w.Message(), "not followed by a labellable block") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a warning for the dangling label, got %v", p.Warnings())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("parser did not return")
+	}
+}
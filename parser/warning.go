@@ -24,8 +24,18 @@ func (w *Warning) String() string {
 			break
 		}
 	}
-	w.args = append([]interface{}{ln}, w.args...)
-	return fmt.Sprintf("line %d: "+w.format, w.args...)
+	args := append([]interface{}{ln}, w.args...)
+	return fmt.Sprintf("line %d: "+w.format, args...)
+}
+
+// Pos returns the offset, in runes, of the warning in the document.
+func (w *Warning) Pos() int {
+	return w.pos
+}
+
+// Message returns the warning text without position information.
+func (w *Warning) Message() string {
+	return fmt.Sprintf(w.format, w.args...)
 }
 
 func (p *Parser) warnAt(pos int, format string, args ...interface{}) {
@@ -0,0 +1,253 @@
+// Package plaintext renders typeup documents as plain text, with wrapped
+// paragraphs, indented lists and ASCII tables.
+package plaintext
+
+import (
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Fprint writes nodes as plain text to w, wrapping lines at width columns.
+func Fprint(w io.Writer, nodes []ast.Node, width int) error {
+	_, err := io.WriteString(w, Print(nodes, width))
+	return err
+}
+
+// Print returns nodes as plain text, wrapping lines at width columns.
+// Code, tables and words longer than width are not wrapped.
+func Print(nodes []ast.Node, width int) string {
+	lines := blocks(nodes, width)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// inline returns n as text, with the URLs of links in angle brackets.
+func inline(n ast.TextNode) string {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		var items []string
+		for _, x := range n.Items {
+			if s := inline(x); s != "" {
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, " ")
+	case *ast.Anchor:
+		text := strings.TrimSpace(inline(n.Text))
+		if text == "" || text == n.URL {
+			return "<" + n.URL + ">"
+		}
+		return text + " <" + n.URL + ">"
+	default:
+		return n.Bare()
+	}
+}
+
+// blocks returns the lines of nodes, with an empty line between blocks.
+func blocks(nodes []ast.Node, width int) []string {
+	var out []string
+	for _, n := range nodes {
+		lines := block(n, width)
+		if len(lines) == 0 {
+			continue
+		}
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, lines...)
+	}
+	return out
+}
+
+func block(n ast.Node, width int) []string {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		return wrap(inline(n), width)
+	case *ast.Heading:
+		title := strings.Join(strings.Fields(n.Number+" "+inline(n.Title)), " ")
+		switch {
+		case n.IsTitle:
+			line := strings.Repeat("=", utf8.RuneCountInString(title))
+			return []string{line, title, line}
+		case n.Level == 1:
+			return []string{title, strings.Repeat("=", utf8.RuneCountInString(title))}
+		case n.Level == 2:
+			return []string{title, strings.Repeat("-", utf8.RuneCountInString(title))}
+		default:
+			return []string{strings.Repeat("#", n.Level) + " " + title}
+		}
+	case *ast.UnorderedList:
+		return list(n.Items, width, func(int) string { return "*" })
+	case *ast.OrderedList:
+		return list(n.Items, width, func(i int) string { return fmt.Sprintf("%d.", i+1) })
+	case *ast.Table:
+		return captioned("Table", n.Number, table(n))
+	case *ast.Code:
+		return captioned("Listing", n.Number, indent(strings.Split(strings.Trim(n.Text, "\n"), "\n"), "    "))
+	case *ast.Image:
+		kind := "image"
+		if n.Number != "" {
+			kind = "Figure " + n.Number
+		}
+		if alt := strings.TrimSpace(n.Attrs["alt"]); alt != "" {
+			return []string{fmt.Sprintf("[%s: %s <%s>]", kind, alt, n.Attrs["src"])}
+		}
+		return []string{fmt.Sprintf("[%s: <%s>]", kind, n.Attrs["src"])}
+	case *ast.Video:
+		return []string{fmt.Sprintf("[video: <%s>]", n.Source)}
+	case *ast.BlockQuote:
+		lines := blocks(n.Blocks, width-2)
+		if n.Attribution != nil || n.Cite != "" {
+			attr := "--"
+			if n.Attribution != nil {
+				attr += " " + inline(n.Attribution)
+			}
+			if n.Cite != "" {
+				attr += " <" + n.Cite + ">"
+			}
+			lines = append(lines, wrap(attr, width-2)...)
+		}
+		return indent(lines, "> ")
+	case *ast.Callout:
+		head := strings.ToUpper(n.Kind) + ":"
+		if n.Title != nil {
+			head += " " + inline(n.Title)
+		}
+		return append(wrap(head, width), indent(blocks(n.Blocks, width-2), "  ")...)
+	case *ast.Math:
+		return indent(strings.Split(n.TeX, "\n"), "    ")
+	case *ast.ThemeBreak:
+		if width < 5 {
+			return []string{"* * *"}
+		}
+		return []string{strings.Repeat(" ", (width-5)/2) + "* * *"}
+	default:
+		return nil
+	}
+}
+
+// captioned prepends a "Table 2:" line to the lines of a numbered block.
+func captioned(kind, number string, lines []string) []string {
+	if number == "" {
+		return lines
+	}
+	return append([]string{kind + " " + number + ":"}, lines...)
+}
+
+// wrap fills the words of s into lines of at most width columns.
+func wrap(s string, width int) []string {
+	var (
+		lines []string
+		line  string
+	)
+	for _, word := range strings.Fields(s) {
+		switch {
+		case line == "":
+			line = word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width:
+			lines = append(lines, line)
+			line = word
+		default:
+			line += " " + word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// indent prefixes each non-empty line with prefix.
+func indent(lines []string, prefix string) []string {
+	out := make([]string, len(lines))
+	for i, ln := range lines {
+		if ln == "" {
+			out[i] = strings.TrimRight(prefix, " ")
+		} else {
+			out[i] = prefix + ln
+		}
+	}
+	return out
+}
+
+func list(items []*ast.ListItem, width int, marker func(i int) string) []string {
+	var (
+		out   []string
+		multi bool // the previous item holds several blocks
+	)
+	for i, x := range items {
+		m := marker(i)
+		pad := strings.Repeat(" ", utf8.RuneCountInString(m)+1)
+		lines := indent(blocks(x.Blocks, width-len(pad)), pad)
+		if len(lines) == 0 {
+			lines = []string{m}
+		} else {
+			lines[0] = m + " " + strings.TrimPrefix(lines[0], pad)
+		}
+		// block items are separated like paragraphs
+		if (multi || len(x.Blocks) > 1) && len(out) > 0 {
+			out = append(out, "")
+		}
+		multi = len(x.Blocks) > 1
+		out = append(out, lines...)
+	}
+	return out
+}
+
+func table(t *ast.Table) []string {
+	rows := make([][]string, 0, len(t.Rows)+1)
+	cells := func(nodes []ast.TextNode) []string {
+		out := make([]string, len(nodes))
+		for i, x := range nodes {
+			out[i] = strings.Join(strings.Fields(inline(x)), " ")
+		}
+		return out
+	}
+	rows = append(rows, cells(t.Headers))
+	for _, r := range t.Rows {
+		rows = append(rows, cells(r))
+	}
+	var widths []int
+	for _, r := range rows {
+		for i, c := range r {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	if len(widths) == 0 {
+		return nil
+	}
+
+	rule := func(ch string) string {
+		var b strings.Builder
+		for _, w := range widths {
+			b.WriteString("+" + strings.Repeat(ch, w+2))
+		}
+		return b.String() + "+"
+	}
+	row := func(r []string) string {
+		var b strings.Builder
+		for i, w := range widths {
+			c := ""
+			if i < len(r) {
+				c = r[i]
+			}
+			b.WriteString("| " + c + strings.Repeat(" ", w-utf8.RuneCountInString(c)) + " ")
+		}
+		return b.String() + "|"
+	}
+	out := []string{rule("-"), row(rows[0]), rule("=")}
+	for _, r := range rows[1:] {
+		out = append(out, row(r))
+	}
+	return append(out, rule("-"))
+}
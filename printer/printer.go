@@ -0,0 +1,507 @@
+package printer
+
+import (
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tableDelims are the table cell delimiters to try, in order of preference.
+var tableDelims = []string{"|", "||", ";", "^"}
+
+// Fprint writes nodes and meta as canonical typeup source to w.
+// Parsing the output and printing it again is meant to give the same
+// text; the documents in testdata are checked for it.
+// Links with a title are printed as reference links, with their
+// definitions at the end of the document.
+func Fprint(w io.Writer, nodes []ast.Node, meta map[string]string) error {
+	_, err := io.WriteString(w, Print(nodes, meta))
+	return err
+}
+
+// Print returns nodes and meta as canonical typeup source.
+func Print(nodes []ast.Node, meta map[string]string) string {
+	var (
+		blocks []string
+		title  string
+	)
+	for _, n := range nodes {
+		if h, ok := n.(*ast.Heading); ok && h.IsTitle {
+			title = h.Title.Bare()
+		}
+	}
+
+	var keys []string
+	for k := range meta {
+		if k != "title" || title == "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		blocks = append(blocks, metaBlock(meta, keys))
+	}
+	blocks = append(blocks, printBlocks(nodes)...)
+	if defs := linkDefs(nodes); defs != "" {
+		blocks = append(blocks, defs)
+	}
+	// a title set after the '=#' heading takes precedence
+	if t, ok := meta["title"]; ok && title != "" && t != title {
+		blocks = append(blocks, metaBlock(meta, []string{"title"}))
+	}
+	if len(blocks) == 0 {
+		return ""
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+func metaBlock(meta map[string]string, keys []string) string {
+	if len(keys) == 1 && !strings.Contains(meta[keys[0]], "}") {
+		return fmt.Sprintf("@{%s = %s}", keys[0], meta[keys[0]])
+	}
+	var out strings.Builder
+	out.WriteString("@{\n")
+	for _, k := range keys {
+		fmt.Fprintf(&out, "%s = %s\n", k, meta[k])
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// printBlocks prints each of nodes.
+// typeup has no syntax for a paragraph break, so adjacent paragraphs,
+// separated in the source by meta data for example, are kept apart with
+// an empty ignore block.
+func printBlocks(nodes []ast.Node) []string {
+	var (
+		out  []string
+		para bool // the last block printed is a paragraph
+	)
+	for _, n := range nodes {
+		s := block(n, 0)
+		if s == "" {
+			continue
+		}
+		_, ok := n.(*ast.TextBlock)
+		if ok && para {
+			out = append(out, "ignore{\n}")
+		}
+		para = ok
+		out = append(out, s)
+	}
+	return out
+}
+
+func block(n ast.Node, depth int) string {
+	s := unlabelled(n, depth)
+	if label := labelOf(n); label != "" && s != "" {
+		return "@label{" + label + "}\n" + s
+	}
+	return s
+}
+
+// labelOf returns the cross reference label of n, if it has one.
+func labelOf(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.Heading:
+		return n.Label
+	case *ast.Table:
+		return n.Label
+	case *ast.Image:
+		return n.Label
+	case *ast.Code:
+		return n.Label
+	default:
+		return ""
+	}
+}
+
+func unlabelled(n ast.Node, depth int) string {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		return paragraph(n)
+	case *ast.Heading:
+		// the parser drops a heading without a title
+		if strings.TrimSpace(inline(n.Title)) == "" {
+			return ""
+		}
+		if n.IsTitle {
+			return "=# " + inline(n.Title)
+		}
+		if n.Unnumbered {
+			return strings.Repeat("#", n.Level) + "* " + inline(n.Title)
+		}
+		return strings.Repeat("#", n.Level) + " " + inline(n.Title)
+	case *ast.UnorderedList:
+		return list("[", "]", n.Items, depth)
+	case *ast.OrderedList:
+		return list("{", "}", n.Items, depth)
+	case *ast.Table:
+		return table(n)
+	case *ast.Code:
+		return code(n)
+	case *ast.Video:
+		return "video[" + n.Source + "]"
+	case *ast.Image:
+		if alt := n.Attrs["alt"]; alt != "" {
+			return fmt.Sprintf("![%s %s]", alt, n.Attrs["src"])
+		}
+		return fmt.Sprintf("![%s]", n.Attrs["src"])
+	case *ast.BlockQuote:
+		return quote(n)
+	case *ast.Callout:
+		return callout(n)
+	case *ast.Math:
+		if strings.Contains(n.TeX, "\n") {
+			return "$$\n" + n.TeX + "\n$$"
+		}
+		return "$$ " + n.TeX + " $$"
+	case *ast.Ignore:
+		if n.Text == "" {
+			return "ignore{\n}"
+		}
+		return "ignore{\n" + n.Text + "\n}"
+	case *ast.ThemeBreak:
+		return "---"
+	case *ast.LinkDef:
+		if n.Title != "" {
+			return fmt.Sprintf("[%s]: %s \"%s\"", n.Label, n.URL, n.Title)
+		}
+		return fmt.Sprintf("[%s]: %s", n.Label, n.URL)
+	default:
+		return ""
+	}
+}
+
+// quote prints q with every line prefixed by '|', which unlike '"""'
+// allows nesting.
+func quote(q *ast.BlockQuote) string {
+	body := strings.Join(printBlocks(q.Blocks), "\n\n")
+	attr := ""
+	if q.Attribution != nil {
+		attr = inline(q.Attribution)
+	}
+	if q.Cite != "" {
+		attr = strings.TrimSpace(attr + " " + q.Cite)
+	}
+	if attr != "" {
+		body += "\n-- " + attr
+	}
+	if strings.TrimSpace(body) == "" {
+		return ""
+	}
+	var out []string
+	for _, ln := range strings.Split(body, "\n") {
+		if ln == "" {
+			out = append(out, "|")
+		} else {
+			out = append(out, "| "+ln)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func callout(c *ast.Callout) string {
+	head := ":::" + c.Kind
+	if c.Title != nil {
+		if t := strings.ReplaceAll(inline(c.Title), "\n", " "); t != "" {
+			head += " " + t
+		}
+	}
+	if len(c.Blocks) == 0 {
+		return head + "\n:::"
+	}
+	return head + "\n" + strings.Join(printBlocks(c.Blocks), "\n\n") + "\n:::"
+}
+
+func paragraph(tb *ast.TextBlock) string {
+	return lines(inline(tb))
+}
+
+// join joins printed inline elements with spaces, unless there is one
+// already. The parser strips the space between an element and the text
+// after it, so none is put before punctuation, except a ':' after a link,
+// which could start a link definition.
+func join(items []string) string {
+	var out strings.Builder
+	for i, s := range items {
+		if i > 0 {
+			c, _ := utf8.DecodeRuneInString(s)
+			prev, _ := utf8.DecodeLastRuneInString(items[i-1])
+			switch {
+			case unicode.IsSpace(c) || unicode.IsSpace(prev):
+			case !strings.ContainsRune(".,;:!?)", c) || c == ':' && prev == ']':
+				out.WriteByte(' ')
+			}
+		}
+		out.WriteString(s)
+	}
+	return out.String()
+}
+
+// defLabel returns the label of the link definition printed for a, which
+// has a title.
+func defLabel(a *ast.Anchor) string {
+	if a.Ref != "" {
+		return a.Ref
+	}
+	return a.URL
+}
+
+// linkDefs returns the link definitions of the links with a title in
+// nodes, which can only be written as reference links, leaving out the
+// ones defined in nodes.
+func linkDefs(nodes []ast.Node) string {
+	var (
+		defs    []string
+		defined = make(map[string]bool)
+	)
+	for _, n := range nodes {
+		ast.Inspect(n, func(n interface{}) bool {
+			if def, ok := n.(*ast.LinkDef); ok {
+				defined[ast.NormalizeLabel(def.Label)] = true
+			}
+			return true
+		})
+	}
+	for _, n := range nodes {
+		ast.Inspect(n, func(n interface{}) bool {
+			a, ok := n.(*ast.Anchor)
+			if !ok || a.Title == "" || a.URL == "" {
+				return true
+			}
+			label := defLabel(a)
+			if key := ast.NormalizeLabel(label); !defined[key] {
+				defined[key] = true
+				defs = append(defs, unlabelled(&ast.LinkDef{Label: label, URL: a.URL, Title: a.Title}, 0))
+			}
+			return true
+		})
+	}
+	return strings.Join(defs, "\n")
+}
+
+// refLink prints a reference link, in the short form "[text][]" if the
+// label is the text.
+func refLink(text, label string) string {
+	if text == label || text == "" {
+		return "[" + label + "][]"
+	}
+	return "[" + text + "][" + label + "]"
+}
+
+// lines strips the whitespace around each line of s and collapses runs
+// of empty lines.
+func lines(s string) string {
+	var out []string
+	blank := false
+	for _, ln := range strings.Split(s, "\n") {
+		trimmed := strings.TrimSpace(ln)
+		if trimmed == "" {
+			blank = len(out) > 0
+			continue
+		}
+		// indentation keeps a line from starting a block
+		if triggers(trimmed) {
+			trimmed = " " + trimmed
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		out = append(out, trimmed)
+	}
+	return strings.Join(out, "\n")
+}
+
+// triggers reports whether the line s could start a block if it were
+// not indented.
+func triggers(s string) bool {
+	for _, kw := range []string{"image", "ignore", "video"} {
+		if strings.HasPrefix(s, kw) {
+			return true
+		}
+	}
+	return strings.ContainsRune("#{[=-`!\"@|:$", rune(s[0]))
+}
+
+func inline(n ast.TextNode) string {
+	switch n := n.(type) {
+	case *ast.Text:
+		return styled(n)
+	case *ast.TextBlock:
+		var items []string
+		for _, x := range n.Items {
+			if s := inline(x); s != "" {
+				items = append(items, s)
+			}
+		}
+		return join(items)
+	case *ast.Anchor:
+		text := strings.TrimSpace(inline(n.Text))
+		switch {
+		case n.Ref != "" && n.URL == "":
+			// not resolved, the definition is in the tree
+			return refLink(text, n.Ref)
+		case n.Title != "":
+			// the definition is printed by linkDefs; a resolved
+			// reference link without a title is printed inline, its
+			// definition having been removed by transform.ResolveLinks
+			return refLink(text, defLabel(n))
+		case text == "" || text == n.URL:
+			return "[" + n.URL + "]"
+		default:
+			return "[" + text + " " + n.URL + "]"
+		}
+	case *ast.InlineCode:
+		if strings.Contains(n.Text, "`") {
+			return "''" + n.Text + "''"
+		}
+		return "`" + n.Text + "`"
+	case *ast.Code:
+		return "`" + strings.TrimSpace(n.Text) + "`"
+	case *ast.Math:
+		return "$" + n.TeX + "$"
+	case *ast.Ref:
+		return "[@" + n.Label + "]"
+	default:
+		return n.Bare()
+	}
+}
+
+// styled returns t with its style markers, which are put inside the
+// spaces around the text.
+func styled(t *ast.Text) string {
+	text := strings.TrimSpace(t.Text)
+	if t.Style == ast.NoStyle || text == "" || text == t.Text {
+		return unspaced(t)
+	}
+	i := strings.Index(t.Text, text)
+	return t.Text[:i] + unspaced(&ast.Text{Style: t.Style, Text: text}) + t.Text[i+len(text):]
+}
+
+func unspaced(t *ast.Text) string {
+	switch t.Style {
+	case ast.Bold:
+		if strings.Contains(t.Text, "_") {
+			return "==" + t.Text + "=="
+		}
+		return "_" + t.Text + "_"
+	case ast.Italic:
+		if strings.Contains(t.Text, "*") {
+			return "//" + t.Text + "//"
+		}
+		return "*" + t.Text + "*"
+	case ast.BoldAndItalic:
+		return "*_" + t.Text + "_*"
+	default:
+		return t.Text
+	}
+}
+
+func list(open, close string, items []*ast.ListItem, depth int) string {
+	indent := strings.Repeat("  ", depth+1)
+	var out strings.Builder
+	out.WriteString(open + "\n")
+	for _, x := range items {
+		if len(x.Blocks) == 1 {
+			switch n := x.Blocks[0].(type) {
+			case *ast.UnorderedList:
+				out.WriteString(indent + list("[", "]", n.Items, depth+1) + "\n")
+				continue
+			case *ast.OrderedList:
+				out.WriteString(indent + list("{", "}", n.Items, depth+1) + "\n")
+				continue
+			case *ast.TextBlock:
+				if s := lines(inline(n)); s != "" {
+					// continuation lines end with a backslash
+					out.WriteString(indent + strings.ReplaceAll(s, "\n", " \\\n"+indent) + "\n")
+				}
+				continue
+			}
+		}
+		// block contents can not be indented
+		out.WriteString(indent + "(\n")
+		if len(x.Blocks) > 0 {
+			out.WriteString(strings.Join(printBlocks(x.Blocks), "\n\n") + "\n")
+		}
+		out.WriteString(indent + ")\n")
+	}
+	out.WriteString(strings.Repeat("  ", depth) + close)
+	return out.String()
+}
+
+func table(t *ast.Table) string {
+	rows := make([][]string, 0, len(t.Rows)+1)
+	cells := func(nodes []ast.TextNode) []string {
+		out := make([]string, len(nodes))
+		for i, x := range nodes {
+			out[i] = strings.ReplaceAll(strings.TrimSpace(inline(x)), "\n", " ")
+		}
+		return out
+	}
+	rows = append(rows, cells(t.Headers))
+	for _, r := range t.Rows {
+		rows = append(rows, cells(r))
+	}
+
+	delim := tableDelims[0]
+DELIMS:
+	for _, d := range tableDelims {
+		delim = d
+		for _, r := range rows {
+			for _, c := range r {
+				if strings.Contains(c, d) {
+					continue DELIMS
+				}
+			}
+		}
+		break
+	}
+
+	var widths []int
+	for _, r := range rows {
+		for i, c := range r {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(c); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "#%s{\n", delim)
+	for _, r := range rows {
+		var ln strings.Builder
+		for i, c := range r {
+			if i > 0 {
+				ln.WriteString(" " + delim + " ")
+			}
+			ln.WriteString(c)
+			if i < len(r)-1 {
+				ln.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c)))
+			}
+		}
+		out.WriteString(strings.TrimRight(ln.String(), " ") + "\n")
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+func code(c *ast.Code) string {
+	delim := "```"
+	if strings.Contains("\n"+c.Text, "\n```") {
+		delim = "==="
+	}
+	text := c.Text
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return delim + text + delim
+}
@@ -0,0 +1,136 @@
+package printer
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"github.com/insomnimus/typeup/transpiler"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func format(src string) string {
+	d := transpiler.Parse(src)
+	return Print(d.Nodes, d.Meta)
+}
+
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.tup"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test data")
+	}
+	files = append(files, filepath.Join("..", "example.tup"))
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		once := format(string(data))
+		if twice := format(once); twice != once {
+			t.Errorf("%s: printing again changed the output\nfirst:\n%s\nsecond:\n%s", path, once, twice)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"x `x`. y\n", "x `x`. y\n"},
+		{"[site] : http://x\n", " [site] : http://x\n"},
+		{"[[s][]\n", " [[s][]\n"},
+		{"a\n@{k = v}\nb\n", "@{k = v}\n\na\n\nignore{\n}\n\nb\n"},
+		{"a\nignore{\nsecret\n}\nb\n", "a\n\nignore{\nsecret\n}\n\nb\n"},
+	}
+	for _, tt := range tests {
+		if got := format(tt.in); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	tests := []string{
+		"a\n| not a quote\n",
+		"a\n  | indented\n",
+		"a\n# not a heading\nb\n",
+		"a\n: not a callout\n",
+		"a\n$ not math\n",
+		"a\n@ not a label\n",
+		"a\n- not a break\n",
+		"a\n= not a heading\n",
+		"a\n{ not a list\n",
+		"a\n[ not a list\n",
+		"a\n! not an image\n",
+		"a\n\"not a quote\n",
+		"a\nimage not an image\n",
+		"a\nignore this\n",
+		"a\nvideo not a video\n",
+		"a `x`\n`y` b\n",
+		"[link http://x] first\n",
+		"\"quoted\" first\n",
+		"*bold* and _italic_\n\n\n\nafter blank lines\n",
+		"| quote\n| #not a heading\n",
+		"text with [a reference][ref]\n\n[ref]: http://x\n",
+		"|| | a\\[l http://x]*x*\n",
+		"{[\\\n",
+		"{[# :# \"\n",
+		"#     \n::video\n",
+		" # [\n",
+		"| # \n@---\"[\n",
+	}
+	for _, src := range tests {
+		once := format(src)
+		if twice := format(once); twice != once {
+			t.Errorf("%q: printing again changed the output\nfirst:\n%s\nsecond:\n%s", src, once, twice)
+		}
+	}
+}
+
+func TestLinkTitles(t *testing.T) {
+	d := transpiler.Parse("see [the site][home] and [another one][other]\n\n[home]: https://example.com \"Home\"\n[other]: https://example.org\n")
+	if _, err := d.Apply(nil); err != nil {
+		t.Fatal(err)
+	}
+	out := Print(d.Nodes, d.Meta)
+	if strings.Contains(out, "[other]") {
+		t.Errorf("a link without a title is printed as a reference link:\n%s", out)
+	}
+	d = transpiler.Parse(out)
+	if len(d.Warnings) > 0 {
+		t.Fatalf("warnings parsing the output: %v\n%s", d.Warnings, out)
+	}
+	warnings, err := d.Apply(nil)
+	if err != nil || len(warnings) > 0 {
+		t.Fatalf("applying the passes to the output: %v %v\n%s", err, warnings, out)
+	}
+	links := make(map[string]string)
+	for _, n := range d.Nodes {
+		ast.Inspect(n, func(n interface{}) bool {
+			if a, ok := n.(*ast.Anchor); ok {
+				links[a.URL] = a.Title
+			}
+			return true
+		})
+	}
+	if title, ok := links["https://example.com"]; !ok || title != "Home" {
+		t.Errorf("the title of the link is lost: %v\n%s", links, out)
+	}
+	if _, ok := links["https://example.org"]; !ok {
+		t.Errorf("the link is lost: %v\n%s", links, out)
+	}
+}
+
+func TestAutolinkSpacing(t *testing.T) {
+	d := transpiler.Parse("visit http://x.org. Or _see http://b.org now_\n")
+	if _, err := d.Apply(nil); err != nil {
+		t.Fatal(err)
+	}
+	const want = "visit [http://x.org]. Or _see_ [_http://b.org_ http://b.org] _now_\n"
+	if got := Print(d.Nodes, d.Meta); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
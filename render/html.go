@@ -0,0 +1,257 @@
+package render
+
+import (
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"github.com/insomnimus/typeup/mathml"
+	"html"
+	"sort"
+	"strings"
+)
+
+var escape = html.EscapeString
+
+// MathMode selects how Math is rendered to HTML.
+type MathMode int
+
+const (
+	MathML MathMode = iota // MathML, needing no JavaScript
+	KaTeX                  // TeX in the delimiters of KaTeX's auto-render extension
+)
+
+// HTML renders nodes to HTML.
+type HTML struct {
+	MathMode  MathMode
+	Overrides Overrides
+}
+
+// Node renders n, which may be a block or a text node.
+func (r *HTML) Node(n interface{}) string {
+	return r.Overrides.Render(r, n)
+}
+
+// text renders n within text, where a TextBlock is not a paragraph.
+func (r *HTML) text(n ast.TextNode) string {
+	tb, ok := n.(*ast.TextBlock)
+	if !ok {
+		return r.Node(n)
+	}
+	var out strings.Builder
+	var tmp string
+	for _, t := range tb.Items {
+		tmp = strings.TrimSpace(r.text(t))
+		if tmp == "" {
+			continue
+		}
+		out.WriteString(tmp)
+		out.WriteRune('\n')
+	}
+	return out.String()
+}
+
+func (r *HTML) TextBlock(t *ast.TextBlock) string {
+	return "<p>\n" + r.text(t) + "</p>"
+}
+
+// listText renders n as the only paragraph of a list item.
+func (r *HTML) listText(n ast.TextNode) string {
+	tb, ok := n.(*ast.TextBlock)
+	if !ok {
+		return r.Node(n)
+	}
+	var out strings.Builder
+	for _, t := range tb.Items {
+		fmt.Fprintf(&out, "%s ", r.listText(t))
+	}
+	return out.String()
+}
+
+func (r *HTML) ListItem(li *ast.ListItem) string {
+	if len(li.Blocks) == 1 {
+		if tb, ok := li.Blocks[0].(*ast.TextBlock); ok {
+			return r.listText(tb)
+		}
+	}
+	var out strings.Builder
+	for _, x := range li.Blocks {
+		out.WriteRune('\n')
+		out.WriteString(r.Node(x))
+	}
+	out.WriteRune('\n')
+	return out.String()
+}
+
+func (r *HTML) Text(t *ast.Text) string {
+	switch t.Style {
+	case ast.Bold:
+		return fmt.Sprintf("<b> %s </b>", escape(t.Text))
+	case ast.Italic:
+		return fmt.Sprintf("<i> %s </i>", escape(t.Text))
+	case ast.BoldAndItalic:
+		return fmt.Sprintf("<b><i> %s </i></b>", escape(t.Text))
+	default:
+		return escape(t.Text)
+	}
+}
+
+func (r *HTML) Heading(h *ast.Heading) string {
+	title := strings.ReplaceAll(r.text(h.Title), "\n", "")
+	if h.Number != "" {
+		title = h.Number + " " + title
+	}
+	if h.ID == "" {
+		return fmt.Sprintf("<h%d> %s </h%d>", h.Level, title, h.Level)
+	}
+	return fmt.Sprintf("<h%d id=%q> %s </h%d>", h.Level, h.ID, title, h.Level)
+}
+
+func (r *HTML) list(tag string, items []*ast.ListItem) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "<%s>\n", tag)
+	for _, x := range items {
+		fmt.Fprintf(&out, "<li> %s </li>\n", r.Node(x))
+	}
+	fmt.Fprintf(&out, "</%s>", tag)
+	return out.String()
+}
+
+func (r *HTML) OrderedList(ol *ast.OrderedList) string {
+	return r.list("ol", ol.Items)
+}
+
+func (r *HTML) UnorderedList(ul *ast.UnorderedList) string {
+	return r.list("ul", ul.Items)
+}
+
+func (r *HTML) Anchor(a *ast.Anchor) string {
+	if a.Title != "" {
+		return fmt.Sprintf("<a href=%q title=\"%s\"> %s </a>", a.URL, escape(a.Title), r.text(a.Text))
+	}
+	return fmt.Sprintf("<a href=%q> %s </a>", a.URL, r.text(a.Text))
+}
+
+func (r *HTML) Table(t *ast.Table) string {
+	var out strings.Builder
+	if t.Label != "" {
+		fmt.Fprintf(&out, `<table id=%q style="width:100%%">`, t.Label)
+	} else {
+		out.WriteString(`<table style="width:100%">`)
+	}
+	if t.Number != "" {
+		fmt.Fprintf(&out, "\n<caption> Table %s </caption>", t.Number)
+	}
+	out.WriteString("\n<tr>\n")
+	for _, x := range t.Headers {
+		fmt.Fprintf(&out, "<th> %s </th>\n", r.text(x))
+	}
+	out.WriteString("</tr>\n")
+	for _, row := range t.Rows {
+		out.WriteString("<tr>\n")
+		for _, x := range row {
+			fmt.Fprintf(&out, "<td> %s </td>\n", r.text(x))
+		}
+		out.WriteString("</tr>\n")
+	}
+	out.WriteString("</table>")
+	return out.String()
+}
+
+func (r *HTML) Code(c *ast.Code) string {
+	return figure(c.Label, "Listing", c.Number, fmt.Sprintf("<pre><code>%s</code></pre>", escape(c.Text)))
+}
+
+// figure wraps the HTML of a labelled node in a figure with a caption
+// like "Figure 2". Unlabelled nodes are returned as they are.
+func figure(label, kind, number, s string) string {
+	if label == "" {
+		return s
+	}
+	if number == "" {
+		return fmt.Sprintf("<figure id=%q>\n%s\n</figure>", label, s)
+	}
+	return fmt.Sprintf("<figure id=%q>\n%s\n<figcaption> %s %s </figcaption>\n</figure>", label, s, kind, number)
+}
+
+func (r *HTML) Video(v *ast.Video) string {
+	return fmt.Sprintf("<video><source src=%q></video>", v.Source)
+}
+
+func (r *HTML) Image(img *ast.Image) string {
+	var out strings.Builder
+	out.WriteString("<img")
+	keys := make([]string, 0, len(img.Attrs))
+	for key := range img.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&out, " %s=%q", key, img.Attrs[key])
+	}
+	out.WriteRune('>')
+	return figure(img.Label, "Figure", img.Number, out.String())
+}
+
+func (r *HTML) BlockQuote(bq *ast.BlockQuote) string {
+	var out strings.Builder
+	if bq.Attribution != nil {
+		out.WriteString("<figure>\n")
+	}
+	if bq.Cite != "" {
+		fmt.Fprintf(&out, "<blockquote cite=%q>\n", bq.Cite)
+	} else {
+		out.WriteString("<blockquote>\n")
+	}
+	for _, x := range bq.Blocks {
+		out.WriteString(r.Node(x))
+		out.WriteRune('\n')
+	}
+	out.WriteString("</blockquote>")
+	if bq.Attribution != nil {
+		fmt.Fprintf(&out, "\n<figcaption> <cite> %s </cite> </figcaption>\n</figure>",
+			strings.TrimSpace(r.text(bq.Attribution)))
+	}
+	return out.String()
+}
+
+func (r *HTML) Callout(c *ast.Callout) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "<aside class=%q>\n", "callout callout-"+c.Kind)
+	if c.Title != nil {
+		fmt.Fprintf(&out, "<p class=\"callout-title\"> %s </p>\n",
+			strings.TrimSpace(r.text(c.Title)))
+	}
+	for _, x := range c.Blocks {
+		out.WriteString(r.Node(x))
+		out.WriteRune('\n')
+	}
+	out.WriteString("</aside>")
+	return out.String()
+}
+
+func (r *HTML) Math(m *ast.Math) string {
+	if r.MathMode == KaTeX {
+		if m.Display {
+			return fmt.Sprintf(`<span class="math display">\[%s\]</span>`, escape(m.TeX))
+		}
+		return fmt.Sprintf(`<span class="math inline">\(%s\)</span>`, escape(m.TeX))
+	}
+	s, err := mathml.Convert(m.TeX, m.Display)
+	if err != nil {
+		return fmt.Sprintf("<math><merror><mtext>%s</mtext></merror></math>", escape(m.TeX))
+	}
+	return s
+}
+
+func (r *HTML) ThemeBreak(*ast.ThemeBreak) string { return "<hr>" }
+func (r *HTML) LineBreak(*ast.LineBreak) string   { return "<br>" }
+func (r *HTML) LinkDef(*ast.LinkDef) string       { return "" }
+func (r *HTML) Ignore(*ast.Ignore) string         { return "" }
+
+// Ref renders a cross reference left unresolved as it is written.
+func (r *HTML) Ref(ref *ast.Ref) string {
+	return escape("[@" + ref.Label + "]")
+}
+
+func (r *HTML) InlineCode(c *ast.InlineCode) string {
+	return fmt.Sprintf("<code> %s </code>", escape(c.Text))
+}
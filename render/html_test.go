@@ -0,0 +1,41 @@
+package render
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"testing"
+)
+
+func TestMath(t *testing.T) {
+	tests := []struct {
+		mode MathMode
+		math ast.Math
+		want string
+	}{
+		{MathML, ast.Math{TeX: `x^2`}, `<math xmlns="http://www.w3.org/1998/Math/MathML"><semantics><mrow><msup><mi>x</mi><mn>2</mn></msup></mrow><annotation encoding="application/x-tex">x^2</annotation></semantics></math>`},
+		// TeX that cannot be converted is shown as it is
+		{MathML, ast.Math{TeX: `\foo{<a>}`}, `<math><merror><mtext>\foo{&lt;a&gt;}</mtext></merror></math>`},
+		{KaTeX, ast.Math{TeX: `a<b`}, `<span class="math inline">\(a&lt;b\)</span>`},
+		{KaTeX, ast.Math{TeX: `a<b`, Display: true}, `<span class="math display">\[a&lt;b\]</span>`},
+	}
+	for _, tt := range tests {
+		r := &HTML{MathMode: tt.mode}
+		if got := r.Math(&tt.math); got != tt.want {
+			t.Errorf("%s\ngot  %s\nwant %s", tt.math.TeX, got, tt.want)
+		}
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	r := &HTML{}
+	if got := r.Node(&ast.Ignore{Text: "secret"}); got != "" {
+		t.Errorf("got %q, want nothing", got)
+	}
+	// ignore blocks can be shown by overriding them like any other node
+	r.Overrides = Overrides{}
+	r.Overrides.Set((*ast.Ignore)(nil), func(_ Renderer, n interface{}) string {
+		return "<!-- " + n.(*ast.Ignore).Text + " -->"
+	})
+	if got, want := r.Node(&ast.Ignore{Text: "secret"}), "<!-- secret -->"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+// Package render turns typeup nodes into output.
+//
+// A Renderer has a method for each kind of node. How single node types
+// are rendered can be changed without writing a Renderer, by registering
+// functions for them in Overrides:
+//
+//	r := &render.HTML{Overrides: render.Overrides{}}
+//	r.Overrides.Set((*ast.Image)(nil), func(r render.Renderer, n interface{}) string {
+//		img := n.(*ast.Image)
+//		return fmt.Sprintf("<picture><img src=%q></picture>", img.Attrs["src"])
+//	})
+package render
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"reflect"
+)
+
+// Renderer renders each kind of node.
+type Renderer interface {
+	TextBlock(*ast.TextBlock) string
+	Heading(*ast.Heading) string
+	OrderedList(*ast.OrderedList) string
+	UnorderedList(*ast.UnorderedList) string
+	ListItem(*ast.ListItem) string
+	Table(*ast.Table) string
+	Code(*ast.Code) string
+	Video(*ast.Video) string
+	Image(*ast.Image) string
+	BlockQuote(*ast.BlockQuote) string
+	Callout(*ast.Callout) string
+	Math(*ast.Math) string
+	ThemeBreak(*ast.ThemeBreak) string
+	LinkDef(*ast.LinkDef) string
+	Ignore(*ast.Ignore) string
+	LineBreak(*ast.LineBreak) string
+	Text(*ast.Text) string
+	Anchor(*ast.Anchor) string
+	InlineCode(*ast.InlineCode) string
+	Ref(*ast.Ref) string
+}
+
+// Func renders the node n in place of a method of r.
+type Func func(r Renderer, n interface{}) string
+
+// Overrides maps node types to the functions rendering them.
+type Overrides map[reflect.Type]Func
+
+// Set makes f render the nodes of the type of node, which may be a nil
+// pointer such as (*ast.Image)(nil).
+func (o Overrides) Set(node interface{}, f Func) {
+	o[reflect.TypeOf(node)] = f
+}
+
+// Render renders n with the function registered in o for its type,
+// or else with the method of r for its kind. Nodes of unknown types
+// render as the empty string.
+func (o Overrides) Render(r Renderer, n interface{}) string {
+	if f := o[reflect.TypeOf(n)]; f != nil {
+		return f(r, n)
+	}
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		return r.TextBlock(n)
+	case *ast.Heading:
+		return r.Heading(n)
+	case *ast.OrderedList:
+		return r.OrderedList(n)
+	case *ast.UnorderedList:
+		return r.UnorderedList(n)
+	case *ast.ListItem:
+		return r.ListItem(n)
+	case *ast.Table:
+		return r.Table(n)
+	case *ast.Code:
+		return r.Code(n)
+	case *ast.Video:
+		return r.Video(n)
+	case *ast.Image:
+		return r.Image(n)
+	case *ast.BlockQuote:
+		return r.BlockQuote(n)
+	case *ast.Callout:
+		return r.Callout(n)
+	case *ast.Math:
+		return r.Math(n)
+	case *ast.ThemeBreak:
+		return r.ThemeBreak(n)
+	case *ast.LinkDef:
+		return r.LinkDef(n)
+	case *ast.Ignore:
+		return r.Ignore(n)
+	case *ast.LineBreak:
+		return r.LineBreak(n)
+	case *ast.Text:
+		return r.Text(n)
+	case *ast.Anchor:
+		return r.Anchor(n)
+	case *ast.InlineCode:
+		return r.InlineCode(n)
+	case *ast.Ref:
+		return r.Ref(n)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"github.com/insomnimus/typeup/serve"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.Usage = func() {
+		fs.Output().Write([]byte("usage: typeup serve [options] [dir]\n"))
+		fs.PrintDefaults()
+	}
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check for changes")
+	mathFlag(fs)
+	configFlag(fs)
+	numberFlag(fs)
+	fs.Parse(args)
+	root := "."
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		root = fs.Arg(0)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	s := &serve.Server{
+		Root:     root,
+		Interval: *interval,
+		Stderr:   os.Stderr,
+		Passes:   pipeline(),
+	}
+	go func() {
+		log.Fatal(s.Watch())
+	}()
+	log.Printf("serving %s on http://%s", root, *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
@@ -0,0 +1,194 @@
+package serve
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/insomnimus/typeup/transform"
+	"github.com/insomnimus/typeup/transpiler"
+	"github.com/insomnimus/typeup/watch"
+	"html"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const eventsPath = "/__typeup/events"
+
+const reloadScript = `<script>
+new EventSource(%q).onmessage = function() { location.reload(); };
+</script>
+`
+
+const overlayStyle = `position:fixed;bottom:0;left:0;right:0;max-height:40%;overflow:auto;` +
+	`margin:0;padding:0.5em 1em;background:#fff3cd;color:#664d03;border-top:2px solid #ffc107;font-family:monospace;`
+
+// Server serves the files under Root, rendering typeup documents to HTML
+// on request. Pages reload in the browser whenever a file under Root changes.
+type Server struct {
+	Root     string
+	Interval time.Duration
+	Stderr   io.Writer
+	Passes   transform.Pipeline // run on every document before rendering
+
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+}
+
+// Watch polls Root for changes and notifies connected browsers.
+// It blocks until watching fails.
+func (s *Server) Watch() error {
+	w := &watch.Watcher{
+		Interval: s.Interval,
+		List:     watch.Dir(s.Root),
+	}
+	return w.Run(func(changed []string) {
+		if s.Stderr != nil {
+			for _, f := range changed {
+				fmt.Fprintf(s.Stderr, "changed %s\n", f)
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for c := range s.clients {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == eventsPath {
+		s.serveEvents(w, r)
+		return
+	}
+	fs := http.Dir(s.Root)
+	name := path.Clean("/" + r.URL.Path)
+	if isDir(fs, name) {
+		if strings.HasSuffix(r.URL.Path, "/") && exists(fs, path.Join(name, "index.tup")) {
+			s.serveDoc(w, r, path.Join(name, "index.tup"))
+			return
+		}
+	} else if strings.HasSuffix(name, ".tup") {
+		s.serveDoc(w, r, name)
+		return
+	} else if strings.HasSuffix(name, ".html") && !exists(fs, name) {
+		// links that were written for the output of typeup build
+		if src := strings.TrimSuffix(name, ".html") + ".tup"; exists(fs, src) {
+			s.serveDoc(w, r, src)
+			return
+		}
+	}
+	http.FileServer(fs).ServeHTTP(w, r)
+}
+
+func (s *Server) serveDoc(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := http.Dir(s.Root).Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	doc := transpiler.Parse(string(data))
+	var warnings []string
+	for _, w := range doc.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	passWarnings, err := doc.Apply(s.Passes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	warnings = append(warnings, passWarnings...)
+	var buf bytes.Buffer
+	if err = doc.WriteHTML(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var extra strings.Builder
+	if len(warnings) > 0 {
+		fmt.Fprintf(&extra, `<div id="typeup-warnings" style="%s">`, overlayStyle)
+		extra.WriteString(`<button style="float:right" onclick="this.parentNode.remove()">&times;</button>`)
+		fmt.Fprintf(&extra, "<b> %d warning(s) in %s </b>\n<ul>\n", len(warnings), html.EscapeString(name))
+		for _, warn := range warnings {
+			fmt.Fprintf(&extra, "<li> %s </li>\n", html.EscapeString(warn))
+		}
+		extra.WriteString("</ul>\n</div>\n")
+	}
+	fmt.Fprintf(&extra, reloadScript, eventsPath)
+
+	page := buf.String()
+	if i := strings.LastIndex(page, "</body>"); i >= 0 {
+		page = page[:i] + extra.String() + page[i:]
+	} else {
+		page += extra.String()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, page)
+}
+
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	c := make(chan struct{}, 1)
+	s.mu.Lock()
+	if s.clients == nil {
+		s.clients = make(map[chan struct{}]bool)
+	}
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c:
+			io.WriteString(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func exists(fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+func isDir(fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,332 @@
+package site
+
+import (
+	"errors"
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"github.com/insomnimus/typeup/transform"
+	"github.com/insomnimus/typeup/transpiler"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Builder struct {
+	Src, Dst string
+	Workers  int
+	Stderr   io.Writer
+	Passes   transform.Pipeline // run on every document before rendering
+
+	mu    sync.Mutex
+	pages map[string]*page
+}
+
+type page struct {
+	src   string // relative to Builder.Src, slash separated
+	title string
+	date  string
+}
+
+func (p *page) out() string {
+	return strings.TrimSuffix(p.src, ".tup") + ".html"
+}
+
+func (b *Builder) Build() error {
+	docs, assets, err := b.scan()
+	if err != nil {
+		return err
+	}
+	b.pages = make(map[string]*page, len(docs))
+	if err = os.MkdirAll(b.Dst, 0o755); err != nil {
+		return err
+	}
+	for _, rel := range assets {
+		if err = b.copyAsset(rel); err != nil {
+			return err
+		}
+	}
+	if err = b.render(docs); err != nil {
+		return err
+	}
+	return b.writeIndex()
+}
+
+// Sources returns the paths of every document and asset under b.Src.
+func (b *Builder) Sources() ([]string, error) {
+	docs, assets, err := b.scan()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, rel := range append(docs, assets...) {
+		files = append(files, filepath.Join(b.Src, filepath.FromSlash(rel)))
+	}
+	return files, nil
+}
+
+// Update brings the output up to date after the files in changed, paths as
+// returned by Sources, were created, modified or removed.
+// Only the changed documents are rendered again, along with the documents
+// that depend on them; currently that is just the generated index.
+func (b *Builder) Update(changed []string) error {
+	if b.pages == nil {
+		return b.Build()
+	}
+	var (
+		docs  []string
+		dirty bool
+		old   = make(map[string]page, len(b.pages))
+	)
+	for rel, pg := range b.pages {
+		old[rel] = *pg
+	}
+	for _, p := range changed {
+		rel, err := filepath.Rel(b.Src, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		isDoc := strings.HasSuffix(rel, ".tup")
+
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			out := rel
+			if isDoc {
+				out = (&page{src: rel}).out()
+				delete(b.pages, rel)
+				dirty = true
+			}
+			if err = os.Remove(filepath.Join(b.Dst, filepath.FromSlash(out))); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			b.logf("removed %s", rel)
+			continue
+		}
+
+		if isDoc {
+			docs = append(docs, rel)
+			continue
+		}
+		if err = b.copyAsset(rel); err != nil {
+			return err
+		}
+		b.logf("copied %s", rel)
+	}
+
+	if err := b.render(docs); err != nil {
+		return err
+	}
+	for _, rel := range docs {
+		b.logf("rebuilt %s", rel)
+		if pg, ok := old[rel]; !ok || pg != *b.pages[rel] {
+			dirty = true
+		}
+	}
+	if dirty {
+		b.logf("rebuilt index")
+		return b.writeIndex()
+	}
+	return nil
+}
+
+func (b *Builder) logf(format string, args ...interface{}) {
+	if b.Stderr != nil {
+		fmt.Fprintf(b.Stderr, format+"\n", args...)
+	}
+}
+
+// scan returns the slash separated paths of documents and assets under b.Src.
+func (b *Builder) scan() (docs, assets []string, err error) {
+	dst, err := filepath.Abs(b.Dst)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = filepath.WalkDir(b.Src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if abs, err := filepath.Abs(p); err == nil && abs == dst {
+				return filepath.SkipDir
+			}
+			if p != b.Src && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(b.Src, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.HasSuffix(rel, ".tup") {
+			docs = append(docs, rel)
+		} else {
+			assets = append(assets, rel)
+		}
+		return nil
+	})
+	return docs, assets, err
+}
+
+func (b *Builder) render(docs []string) error {
+	workers := b.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	var (
+		wg   sync.WaitGroup
+		jobs = make(chan string)
+		errs = make(chan error, len(docs))
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rel := range jobs {
+				if err := b.renderPage(rel); err != nil {
+					errs <- fmt.Errorf("%s: %w", rel, err)
+				}
+			}
+		}()
+	}
+	for _, rel := range docs {
+		jobs <- rel
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	var msgs []string
+	for err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	if len(msgs) > 0 {
+		sort.Strings(msgs)
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+func (b *Builder) renderPage(rel string) error {
+	data, err := os.ReadFile(filepath.Join(b.Src, filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+	doc := transpiler.Parse(string(data))
+	// render adds the path to the errors
+	warnings, err := doc.Apply(b.Passes)
+	if err != nil {
+		return err
+	}
+	for _, n := range doc.Nodes {
+		ast.Inspect(n, rewriteLink)
+	}
+
+	pg := &page{
+		src:   rel,
+		title: doc.Meta["title"],
+		date:  doc.Meta["date"],
+	}
+	if pg.title == "" {
+		pg.title = strings.TrimSuffix(path.Base(rel), ".tup")
+	}
+
+	out := filepath.Join(b.Dst, filepath.FromSlash(pg.out()))
+	if err = os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	err = doc.WriteHTML(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pages[rel] = pg
+	if b.Stderr != nil {
+		for _, w := range doc.Warnings {
+			fmt.Fprintf(b.Stderr, "%s: %s\n", rel, w)
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(b.Stderr, "%s: %s\n", rel, w)
+		}
+	}
+	return nil
+}
+
+// rewriteLink changes links to local .tup documents to point at the
+// generated .html files.
+func rewriteLink(n interface{}) bool {
+	a, ok := n.(*ast.Anchor)
+	if !ok {
+		return true
+	}
+	u, err := url.Parse(a.URL)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasSuffix(u.Path, ".tup") {
+		return true
+	}
+	u.Path = strings.TrimSuffix(u.Path, ".tup") + ".html"
+	a.URL = u.String()
+	return true
+}
+
+func (b *Builder) copyAsset(rel string) error {
+	src, err := os.Open(filepath.Join(b.Src, filepath.FromSlash(rel)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	out := filepath.Join(b.Dst, filepath.FromSlash(rel))
+	if err = os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return err
+	}
+	dst, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// writeIndex generates index.html listing every document,
+// unless the source tree has its own index.tup.
+func (b *Builder) writeIndex() error {
+	if _, ok := b.pages["index.tup"]; ok {
+		return nil
+	}
+	pages := make([]*page, 0, len(b.pages))
+	for _, pg := range b.pages {
+		pages = append(pages, pg)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].src < pages[j].src })
+
+	var out strings.Builder
+	out.WriteString("<html>\n<head> <title>\n Index \n</title> </head>\n<body>\n<h1> Index </h1>\n<ul>\n")
+	for _, pg := range pages {
+		href := (&url.URL{Path: pg.out()}).String()
+		fmt.Fprintf(&out, "<li> <a href=\"%s\"> %s </a>", html.EscapeString(href), html.EscapeString(pg.title))
+		if pg.date != "" {
+			fmt.Fprintf(&out, " <small> %s </small>", html.EscapeString(pg.date))
+		}
+		out.WriteString(" </li>\n")
+	}
+	out.WriteString("</ul>\n</body>\n</html>")
+	return os.WriteFile(filepath.Join(b.Dst, "index.html"), []byte(out.String()), 0o644)
+}
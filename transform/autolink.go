@@ -0,0 +1,136 @@
+package transform
+
+import (
+	"encoding/json"
+	"github.com/insomnimus/typeup/ast"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	Register("autolink", func(json.RawMessage) (Pass, error) {
+		return Autolink(), nil
+	})
+}
+
+var linkRe = regexp.MustCompile(`(?i)\b(?:https?://|ftp://|www\.)[^\s<>]+|\b[a-z0-9._%+-]+@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}\b`)
+
+// Autolink returns a pass turning the URLs and email addresses in text
+// into links, wherever text can hold one. Setting the meta data key
+// "autolink" to "off" disables it for a document.
+func Autolink() Pass {
+	return func(d *Document) error {
+		switch strings.ToLower(d.Meta["autolink"]) {
+		case "off", "false", "no":
+			return nil
+		}
+		d.Walk(func(n interface{}) bool {
+			// text that is not in a text block, as imported documents
+			// can have, is put in one to be split around the links
+			switch n := n.(type) {
+			case *ast.Heading:
+				n.Title = linkable(n.Title)
+			case *ast.Table:
+				for i, x := range n.Headers {
+					n.Headers[i] = linkable(x)
+				}
+				for _, row := range n.Rows {
+					for i, x := range row {
+						row[i] = linkable(x)
+					}
+				}
+			case *ast.Callout:
+				if n.Title != nil {
+					n.Title = linkable(n.Title)
+				}
+			case *ast.BlockQuote:
+				if n.Attribution != nil {
+					n.Attribution = linkable(n.Attribution)
+				}
+			}
+			switch n := n.(type) {
+			case *ast.Anchor:
+				return false
+			case *ast.TextBlock:
+				var items []ast.TextNode
+				for _, x := range n.Items {
+					if t, ok := x.(*ast.Text); ok {
+						items = append(items, autolink(t)...)
+					} else {
+						items = append(items, x)
+					}
+				}
+				n.Items = items
+			}
+			return true
+		})
+		return nil
+	}
+}
+
+// linkable returns x in a text block if it is text with links in it.
+func linkable(x ast.TextNode) ast.TextNode {
+	if t, ok := x.(*ast.Text); ok && len(autolink(t)) > 1 {
+		return &ast.TextBlock{Items: []ast.TextNode{t}}
+	}
+	return x
+}
+
+// autolink splits t around the links in it. The text around a link keeps
+// its spaces, so it can be told whether punctuation follows the link
+// directly.
+func autolink(t *ast.Text) []ast.TextNode {
+	var (
+		out  []ast.TextNode
+		last int
+	)
+	text := func(s string) {
+		if s != "" {
+			out = append(out, &ast.Text{Style: t.Style, Text: s})
+		}
+	}
+	for _, m := range linkRe.FindAllStringIndex(t.Text, -1) {
+		start, end := m[0], m[0]+len(trimURL(t.Text[m[0]:m[1]]))
+		// part of a word or of a longer link, like an address in a URL
+		if start > 0 && strings.ContainsRune("/:@.", rune(t.Text[start-1])) || end == start {
+			continue
+		}
+		link := t.Text[start:end]
+		url := link
+		switch {
+		case strings.Contains(link, "://"):
+		case strings.HasPrefix(strings.ToLower(link), "www."):
+			url = "https://" + link
+		default:
+			url = "mailto:" + link
+		}
+		text(t.Text[last:start])
+		out = append(out, &ast.Anchor{
+			Text: &ast.Text{Style: t.Style, Text: link},
+			URL:  url,
+		})
+		last = end
+	}
+	if last == 0 {
+		return []ast.TextNode{t}
+	}
+	text(t.Text[last:])
+	return out
+}
+
+// trimURL removes the punctuation that ends the sentence around a URL
+// rather than the URL, keeping closing brackets that have a match in it.
+func trimURL(s string) string {
+	for len(s) > 0 {
+		c := s[len(s)-1]
+		switch {
+		case strings.IndexByte(".,:;!?'\"*_", c) >= 0:
+		case c == ')' && strings.Count(s, "(") < strings.Count(s, ")"):
+		case c == ']' && strings.Count(s, "[") < strings.Count(s, "]"):
+		default:
+			return s
+		}
+		s = s[:len(s)-1]
+	}
+	return s
+}
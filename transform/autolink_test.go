@@ -0,0 +1,45 @@
+package transform
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"testing"
+)
+
+func TestAutolinkContainers(t *testing.T) {
+	text := func() ast.TextNode { return &ast.Text{Text: "see https://example.com"} }
+	d := &Document{Nodes: []ast.Node{
+		&ast.Heading{Level: 1, Title: text()},
+		&ast.Table{Headers: []ast.TextNode{text()}, Rows: [][]ast.TextNode{{text()}}},
+		&ast.Callout{Kind: "note", Title: text()},
+		&ast.BlockQuote{Attribution: text()},
+	}}
+	if err := Autolink()(d); err != nil {
+		t.Fatal(err)
+	}
+	links := 0
+	d.Walk(func(n interface{}) bool {
+		if _, ok := n.(*ast.Anchor); ok {
+			links++
+		}
+		return true
+	})
+	if links != 5 {
+		t.Errorf("got %d links, want 5", links)
+	}
+}
+
+func TestAutolinkSpaces(t *testing.T) {
+	tb := &ast.TextBlock{Items: []ast.TextNode{&ast.Text{Text: "visit https://example.com. Or mail a@example.com, then"}}}
+	if err := Autolink()(&Document{Nodes: []ast.Node{tb}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"visit ", "https://example.com", ". Or mail ", "a@example.com", ", then"}
+	if len(tb.Items) != len(want) {
+		t.Fatalf("got %d items, want %d", len(tb.Items), len(want))
+	}
+	for i, x := range tb.Items {
+		if x.Bare() != want[i] {
+			t.Errorf("item %d is %q, want %q", i, x.Bare(), want[i])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package transform
+
+import (
+	"encoding/json"
+	"github.com/insomnimus/typeup/ast"
+)
+
+func init() {
+	Register("resolve-links", func(json.RawMessage) (Pass, error) {
+		return ResolveLinks(), nil
+	})
+}
+
+// ResolveLinks returns a pass filling in the URL and title of reference
+// links from the link definitions, which it removes. It warns about
+// labels that are not defined, defined twice or never used.
+// Links resolved by an earlier run are left alone, so the pass can run
+// more than once.
+func ResolveLinks() Pass {
+	return func(d *Document) error {
+		var (
+			defs  = make(map[string]*ast.LinkDef)
+			order []string
+			used  = make(map[string]bool)
+		)
+		// the definitions are removed at the end, so warnings about
+		// them can tell where they are
+		d.Walk(func(n interface{}) bool {
+			def, ok := n.(*ast.LinkDef)
+			if !ok {
+				return true
+			}
+			label := ast.NormalizeLabel(def.Label)
+			if _, dup := defs[label]; dup {
+				d.WarnAt(def, "link label %q defined more than once, using the first definition", def.Label)
+			} else {
+				defs[label] = def
+				order = append(order, label)
+			}
+			return true
+		})
+		resolve := func(a *ast.Anchor) bool {
+			label := ast.NormalizeLabel(a.Ref)
+			def := defs[label]
+			if def == nil {
+				d.WarnAt(a, "link label %q is not defined", a.Ref)
+				return false
+			}
+			used[label] = true
+			a.URL, a.Title = def.URL, def.Title
+			return true
+		}
+		d.Walk(func(n interface{}) bool {
+			switch n := n.(type) {
+			case *ast.TextBlock:
+				// links to undefined labels are left as they are
+				// written; the ones with a URL are resolved already, by
+				// an earlier run
+				for i, x := range n.Items {
+					if a, ok := x.(*ast.Anchor); ok && a.Ref != "" && a.URL == "" && !resolve(a) {
+						n.Items[i] = unresolved(a)
+					}
+				}
+			case *ast.Anchor:
+				if n.Ref != "" && n.URL == "" {
+					resolve(n)
+				}
+			}
+			return true
+		})
+		for _, label := range order {
+			if !used[label] {
+				d.WarnAt(defs[label], "link label %q is never used", defs[label].Label)
+			}
+		}
+		d.Nodes = filterBlocks(d.Nodes, func(n ast.Node) bool {
+			_, ok := n.(*ast.LinkDef)
+			return !ok
+		})
+		return nil
+	}
+}
+
+// unresolved returns the source of the reference link a, whose label is
+// not defined, as text.
+func unresolved(a *ast.Anchor) *ast.Text {
+	text := a.Text.Bare()
+	if ast.NormalizeLabel(text) == ast.NormalizeLabel(a.Ref) {
+		return &ast.Text{Text: "[" + text + "][]"}
+	}
+	return &ast.Text{Text: "[" + text + "][" + a.Ref + "]"}
+}
+
+// filterBlocks returns the nodes for which keep returns true, removing
+// the others from the blocks nested in them as well.
+func filterBlocks(nodes []ast.Node, keep func(ast.Node) bool) []ast.Node {
+	var out []ast.Node
+	for _, n := range nodes {
+		if !keep(n) {
+			continue
+		}
+		switch n := n.(type) {
+		case *ast.UnorderedList:
+			for _, x := range n.Items {
+				x.Blocks = filterBlocks(x.Blocks, keep)
+			}
+		case *ast.OrderedList:
+			for _, x := range n.Items {
+				x.Blocks = filterBlocks(x.Blocks, keep)
+			}
+		case *ast.BlockQuote:
+			n.Blocks = filterBlocks(n.Blocks, keep)
+		case *ast.Callout:
+			n.Blocks = filterBlocks(n.Blocks, keep)
+		}
+		out = append(out, n)
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package transform
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"github.com/insomnimus/typeup/parser"
+	"testing"
+)
+
+func parse(t *testing.T, src string) *Document {
+	t.Helper()
+	p := parser.New(src)
+	var (
+		nodes     []ast.Node
+		positions = make(map[ast.Node]Position)
+	)
+	for start := p.Pos(); ; start = p.Pos() {
+		n := p.Next()
+		if n == nil {
+			break
+		}
+		nodes = append(nodes, n)
+		line, column := p.LineColumn(start)
+		positions[n] = Position{line, column}
+	}
+	return &Document{Nodes: nodes, Meta: p.Metas(), Positions: positions}
+}
+
+func TestResolveLinksTwice(t *testing.T) {
+	d := parse(t, "see [the site][home]\n\n[home]: https://example.com \"Home\"\n")
+	if err := (Pipeline{ResolveLinks(), ResolveLinks()}).Run(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", d.Warnings)
+	}
+	var found bool
+	d.Walk(func(n interface{}) bool {
+		if a, ok := n.(*ast.Anchor); ok {
+			found = true
+			if a.URL != "https://example.com" || a.Title != "Home" {
+				t.Errorf("got link to %q titled %q", a.URL, a.Title)
+			}
+		}
+		return true
+	})
+	if !found {
+		t.Error("the reference link was turned into text")
+	}
+}
+
+func TestAdjacentLinks(t *testing.T) {
+	d := parse(t, "[docs a.html][guide b.html] and [x][nope]\n")
+	if err := (Pipeline{ResolveLinks()}).Run(d); err != nil {
+		t.Fatal(err)
+	}
+	var urls, texts []string
+	d.Walk(func(n interface{}) bool {
+		switch n := n.(type) {
+		case *ast.Anchor:
+			urls = append(urls, n.URL)
+		case *ast.Text:
+			texts = append(texts, n.Text)
+		}
+		return true
+	})
+	if len(urls) != 2 || urls[0] != "a.html" || urls[1] != "b.html" {
+		t.Errorf("expected links to a.html and b.html, got %q", urls)
+	}
+	var kept bool
+	for _, s := range texts {
+		kept = kept || s == "[x][nope]"
+	}
+	if !kept {
+		t.Errorf("the undefined reference was not kept as written: %q", texts)
+	}
+	if len(d.Warnings) != 1 {
+		t.Errorf("expected a single warning, got %q", d.Warnings)
+	}
+}
+
+func TestURLLabel(t *testing.T) {
+	d := parse(t, "[site][https://example.com]\n\n[https://example.com]: https://example.com \"Home\"\n")
+	if err := (Pipeline{ResolveLinks()}).Run(d); err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	d.Walk(func(n interface{}) bool {
+		if a, ok := n.(*ast.Anchor); ok {
+			titles = append(titles, a.Title)
+		}
+		return true
+	})
+	if len(titles) != 1 || titles[0] != "Home" || len(d.Warnings) > 0 {
+		t.Errorf("a defined label looking like a URL is not resolved: %q %q", titles, d.Warnings)
+	}
+}
+
+func TestWarningPositions(t *testing.T) {
+	d := parse(t, "# Intro\n\n  see [x][nope] and [@missing]\n\n[unused]: https://example.com\n[unused]: https://example.org\n")
+	if err := (Pipeline{ResolveLinks(), CrossReferences()}).Run(d); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`6:1: link label "unused" defined more than once, using the first definition`,
+		`3:3: link label "nope" is not defined`,
+		`5:1: link label "unused" is never used`,
+		`3:3: reference to undefined label "missing"`,
+	}
+	if len(d.Warnings) != len(want) {
+		t.Fatalf("got warnings %q, want %q", d.Warnings, want)
+	}
+	for i, w := range d.Warnings {
+		if w != want[i] {
+			t.Errorf("got warning %q, want %q", w, want[i])
+		}
+	}
+}
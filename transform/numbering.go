@@ -0,0 +1,84 @@
+package transform
+
+import (
+	"encoding/json"
+	"github.com/insomnimus/typeup/ast"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("number-sections", func(json.RawMessage) (Pass, error) {
+		return NumberSections(), nil
+	})
+}
+
+// Numbering returns a pass running NumberSections if the "numbering"
+// meta data key is "on", or if it is not set and enabled is true.
+func Numbering(enabled bool) Pass {
+	return func(d *Document) error {
+		on := enabled
+		switch strings.ToLower(d.Meta["numbering"]) {
+		case "on", "true", "yes":
+			on = true
+		case "off", "false", "no":
+			on = false
+		}
+		if !on {
+			return nil
+		}
+		return NumberSections()(d)
+	}
+}
+
+// NumberSections returns a pass numbering the headings other than the
+// title and those declared unnumbered hierarchically, as in "1", "1.1"
+// and "1.1.2". The highest level used in the document gets one number.
+// It can run before or after CrossReferences.
+func NumberSections() Pass {
+	return func(d *Document) error {
+		var headings []*ast.Heading
+		top := 6
+		d.Walk(func(n interface{}) bool {
+			h, ok := n.(*ast.Heading)
+			if !ok {
+				return true
+			}
+			h.Number = ""
+			if !h.IsTitle && !h.Unnumbered {
+				headings = append(headings, h)
+				if l := clampLevel(h.Level); l < top {
+					top = l
+				}
+			}
+			return false
+		})
+		var counts [6]int
+		for _, h := range headings {
+			level := clampLevel(h.Level)
+			counts[level-1]++
+			for i := level; i < len(counts); i++ {
+				counts[i] = 0
+			}
+			nums := make([]string, 0, level-top+1)
+			for _, c := range counts[top-1 : level] {
+				nums = append(nums, strconv.Itoa(c))
+			}
+			h.Number = strings.Join(nums, ".")
+		}
+		// cross references made before, when enabled in a config file
+		for a, h := range d.headingRefs {
+			a.Text = &ast.Text{Text: headingText(h)}
+		}
+		return nil
+	}
+}
+
+func clampLevel(level int) int {
+	if level < 1 {
+		return 1
+	} else if level > 6 {
+		return 6
+	}
+	return level
+}
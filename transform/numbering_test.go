@@ -0,0 +1,67 @@
+package transform
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"testing"
+)
+
+func TestNumberingAndCrossReferences(t *testing.T) {
+	const src = "# Intro\n\n@label{x}\n## Details\n\nsee [@x]\n"
+	fromConfig, err := New("number-sections", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		pl   Pipeline
+	}{
+		{"before", Pipeline{NumberSections(), CrossReferences()}},
+		{"after", Pipeline{CrossReferences(), NumberSections()}},
+		{"config", append(Defaults[:len(Defaults):len(Defaults)], fromConfig)},
+	}
+	for _, tt := range tests {
+		d := parse(t, src)
+		if err := tt.pl.Run(d); err != nil {
+			t.Fatal(err)
+		}
+		var text string
+		d.Walk(func(n interface{}) bool {
+			if a, ok := n.(*ast.Anchor); ok && a.URL == "#details" {
+				text = a.Bare()
+			}
+			return true
+		})
+		if text != "Section 1.1" {
+			t.Errorf("%s: got reference text %q, want %q", tt.name, text, "Section 1.1")
+		}
+	}
+}
+
+func TestNumbering(t *testing.T) {
+	tests := []struct {
+		meta    string
+		enabled bool
+		want    string
+	}{
+		{"", false, ""},
+		{"", true, "1"},
+		{"@{numbering = on}\n", false, "1"},
+		{"@{numbering = off}\n", true, ""},
+	}
+	for _, tt := range tests {
+		d := parse(t, tt.meta+"# Intro\n")
+		if err := Numbering(tt.enabled)(d); err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		d.Walk(func(n interface{}) bool {
+			if h, ok := n.(*ast.Heading); ok {
+				got = h.Number
+			}
+			return true
+		})
+		if got != tt.want {
+			t.Errorf("%q, enabled %v: got number %q, want %q", tt.meta, tt.enabled, got, tt.want)
+		}
+	}
+}
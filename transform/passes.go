@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"encoding/json"
+	"github.com/insomnimus/typeup/ast"
+	"sort"
+	"strings"
+)
+
+func init() {
+	Register("shift-headings", func(options json.RawMessage) (Pass, error) {
+		var opts struct {
+			By int `json:"by"`
+		}
+		if err := decode(options, &opts); err != nil {
+			return nil, err
+		}
+		return ShiftHeadings(opts.By), nil
+	})
+	Register("rewrite-links", func(options json.RawMessage) (Pass, error) {
+		var prefixes map[string]string
+		if err := decode(options, &prefixes); err != nil {
+			return nil, err
+		}
+		return RewriteLinks(prefixes), nil
+	})
+}
+
+func decode(options json.RawMessage, v interface{}) error {
+	if options == nil {
+		return nil
+	}
+	return json.Unmarshal(options, v)
+}
+
+// Walk calls f for every node in d, like ast.Inspect.
+func (d *Document) Walk(f func(interface{}) bool) {
+	for _, n := range d.Nodes {
+		ast.Inspect(n, f)
+	}
+}
+
+// ShiftHeadings returns a pass adding by to the level of the headings
+// other than the title, keeping the levels between 1 and 6.
+func ShiftHeadings(by int) Pass {
+	return func(d *Document) error {
+		d.Walk(func(n interface{}) bool {
+			h, ok := n.(*ast.Heading)
+			if !ok || h.IsTitle {
+				return true
+			}
+			h.Level = clampLevel(h.Level + by)
+			return true
+		})
+		return nil
+	}
+}
+
+// RewriteLinks returns a pass replacing the prefixes of link and image
+// URLs by the ones they map to. The longest matching prefix wins.
+func RewriteLinks(prefixes map[string]string) Pass {
+	var keys []string
+	for k := range prefixes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	rewrite := func(u string) string {
+		for _, k := range keys {
+			if strings.HasPrefix(u, k) {
+				return prefixes[k] + u[len(k):]
+			}
+		}
+		return u
+	}
+	return func(d *Document) error {
+		d.Walk(func(n interface{}) bool {
+			switch n := n.(type) {
+			case *ast.Anchor:
+				n.URL = rewrite(n.URL)
+			case *ast.Image:
+				if src, ok := n.Attrs["src"]; ok {
+					n.Attrs["src"] = rewrite(src)
+				}
+			case *ast.Video:
+				n.Source = rewrite(n.Source)
+			}
+			return true
+		})
+		return nil
+	}
+}
@@ -0,0 +1,175 @@
+// Package transform rewrites documents between parsing and rendering.
+//
+// A Pass changes a document in place; a Pipeline runs passes in order.
+// Passes registered by name can also be listed in a JSON config file:
+//
+//	{
+//		"passes": [
+//			{"name": "shift-headings", "options": {"by": 1}},
+//			{"name": "rewrite-links", "options": {"http://old.example/": "https://example.com/"}}
+//		]
+//	}
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/insomnimus/typeup/ast"
+	"io"
+	"os"
+	"sort"
+)
+
+// Document is a parsed document as seen by passes.
+type Document struct {
+	Nodes []ast.Node
+	Meta  map[string]string
+	// Warnings holds the problems reported by passes.
+	Warnings []string
+	// Positions holds where the top level nodes start in the source, if
+	// it is known, for warnings to point at.
+	Positions map[ast.Node]Position
+	// headingRefs are the links made by CrossReferences to headings, whose
+	// text NumberSections updates when it runs later.
+	headingRefs map[*ast.Anchor]*ast.Heading
+}
+
+// Warn reports a problem found in d.
+func (d *Document) Warn(format string, args ...interface{}) {
+	d.Warnings = append(d.Warnings, fmt.Sprintf(format, args...))
+}
+
+// WarnAt reports a problem with n, a node of d, at the position of the
+// top level node it is in if that is known.
+func (d *Document) WarnAt(n interface{}, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if pos, ok := d.position(n); ok {
+		msg = fmt.Sprintf("%d:%d: %s", pos.Line, pos.Column, msg)
+	}
+	d.Warnings = append(d.Warnings, msg)
+}
+
+func (d *Document) position(n interface{}) (Position, bool) {
+	for _, top := range d.Nodes {
+		pos, ok := d.Positions[top]
+		if !ok {
+			continue
+		}
+		found := false
+		ast.Inspect(top, func(x interface{}) bool {
+			found = found || x == n
+			return !found
+		})
+		if found {
+			return pos, true
+		}
+	}
+	return Position{}, false
+}
+
+// Position is a location in the source of a document, counting from 1.
+type Position struct {
+	Line, Column int
+}
+
+// A Pass rewrites a document. It may replace, insert or remove nodes.
+// Passes may run on several documents at once, as typeup build does.
+type Pass func(d *Document) error
+
+// Pipeline is a list of passes run in order.
+type Pipeline []Pass
+
+// Run runs the passes of pl on d, stopping at the first error.
+func (pl Pipeline) Run(d *Document) error {
+	if d.Meta == nil {
+		d.Meta = make(map[string]string)
+	}
+	for _, pass := range pl {
+		if err := pass(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Defaults are the passes run on every document by
+// transpiler.Document.Apply, before any others.
+var Defaults = Pipeline{ResolveLinks(), Numbering(false), CrossReferences(), Autolink()}
+
+// Factory makes a pass from its options in a config file, which are nil
+// if there are none.
+type Factory func(options json.RawMessage) (Pass, error)
+
+var registry = make(map[string]Factory)
+
+// Register makes a pass available to config files by name.
+// It panics if the name is already taken.
+func Register(name string, f Factory) {
+	if _, ok := registry[name]; ok {
+		panic("transform: pass " + name + " registered twice")
+	}
+	registry[name] = f
+}
+
+// New returns the pass registered as name, made with options.
+func New(name string, options json.RawMessage) (Pass, error) {
+	f := registry[name]
+	if f == nil {
+		return nil, fmt.Errorf("unknown pass %q", name)
+	}
+	pass, err := f(options)
+	if err != nil {
+		return nil, fmt.Errorf("pass %s: %w", name, err)
+	}
+	return pass, nil
+}
+
+// Names returns the names of the registered passes, sorted.
+func Names() []string {
+	var names []string
+	for k := range registry {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type config struct {
+	Passes []struct {
+		Name    string          `json:"name"`
+		Options json.RawMessage `json:"options"`
+	} `json:"passes"`
+}
+
+// Load reads a config file from r and returns its pipeline.
+func Load(r io.Reader) (Pipeline, error) {
+	var c config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	var pl Pipeline
+	for _, p := range c.Passes {
+		pass, err := New(p.Name, p.Options)
+		if err != nil {
+			return nil, err
+		}
+		pl = append(pl, pass)
+	}
+	return pl, nil
+}
+
+// LoadFile reads the config file at path and returns its pipeline.
+func LoadFile(path string) (Pipeline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pl, err := Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pl, nil
+}
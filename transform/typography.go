@@ -0,0 +1,239 @@
+package transform
+
+import (
+	"encoding/json"
+	"github.com/insomnimus/typeup/ast"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("typography", func(options json.RawMessage) (Pass, error) {
+		var opts struct {
+			Lang string `json:"lang"`
+		}
+		if err := decode(options, &opts); err != nil {
+			return nil, err
+		}
+		return Typography(opts.Lang), nil
+	})
+}
+
+const (
+	nbsp       = "\u00a0"
+	narrowNbsp = "\u202f"
+)
+
+// locale holds the typographic conventions of a language.
+type locale struct {
+	// opening and closing double quotes, then single quotes
+	quotes [4]string
+	// spacing before two-part punctuation and inside guillemets
+	french bool
+}
+
+var locales = map[string]locale{
+	"en": {quotes: [4]string{"“", "”", "‘", "’"}},
+	"nl": {quotes: [4]string{"“", "”", "‘", "’"}},
+	"de": {quotes: [4]string{"„", "“", "‚", "‘"}},
+	"fr": {quotes: [4]string{"«" + narrowNbsp, narrowNbsp + "»", "‹" + narrowNbsp, narrowNbsp + "›"}, french: true},
+	"es": {quotes: [4]string{"«", "»", "“", "”"}},
+	"it": {quotes: [4]string{"«", "»", "“", "”"}},
+	"pt": {quotes: [4]string{"«", "»", "“", "”"}},
+	"ru": {quotes: [4]string{"«", "»", "„", "“"}},
+	"pl": {quotes: [4]string{"„", "”", "«", "»"}},
+	"sv": {quotes: [4]string{"”", "”", "’", "’"}},
+	"ja": {quotes: [4]string{"「", "」", "『", "』"}},
+}
+
+// languages maps the language names used in lang meta data to codes.
+var languages = map[string]string{
+	"english":    "en",
+	"dutch":      "nl",
+	"german":     "de",
+	"french":     "fr",
+	"spanish":    "es",
+	"italian":    "it",
+	"portuguese": "pt",
+	"russian":    "ru",
+	"polish":     "pl",
+	"swedish":    "sv",
+	"japanese":   "ja",
+}
+
+// localeOf returns the conventions of lang, which is a language name
+// such as "english" or a tag such as "en-GB". It defaults to English.
+func localeOf(lang string) locale {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if code, ok := languages[lang]; ok {
+		lang = code
+	}
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	if l, ok := locales[lang]; ok {
+		return l
+	}
+	return locales["en"]
+}
+
+var (
+	// longer units come first, as a match followed by a letter is skipped
+	// rather than retried
+	unitRe   = regexp.MustCompile(`(\d) (%|‰|°[CF]?|[kMGT]i?B|[kMG]?Hz|min|[mµn]?s|[km]?g|[km]?V|[kM]?W|[mµ]?A|[cm]?[lL]|[kcmµn]?m|h|K|px|pt|em|€|£|\$)`)
+	frenchRe = regexp.MustCompile(` ([;!?:»›])`)
+	guillRe  = regexp.MustCompile(`([«‹]) `)
+)
+
+// Typography returns a pass replacing straight quotes with curly ones,
+// "--" and "---" with en and em dashes and "..." with an ellipsis, and
+// putting non-breaking spaces between numbers and units. The rules for
+// quotes and French punctuation are those of lang, or of the lang meta
+// data if lang is empty. Code and math are left as they are.
+func Typography(lang string) Pass {
+	return func(d *Document) error {
+		loc := localeOf(lang)
+		if lang == "" {
+			loc = localeOf(d.Meta["lang"])
+		}
+		done := make(map[*ast.Text]bool)
+		d.Walk(func(n interface{}) bool {
+			// quotes depend on the text around them, so paragraphs are
+			// done as a whole, in order
+			if t, ok := n.(ast.TextNode); ok {
+				var prev rune
+				loc.text(t, &prev, done)
+				return false
+			}
+			return true
+		})
+		return nil
+	}
+}
+
+// text makes the substitutions of l in the text of n. prev holds the
+// rune before n and is updated to the last one of n.
+func (l locale) text(n ast.TextNode, prev *rune, done map[*ast.Text]bool) {
+	switch n := n.(type) {
+	case *ast.TextBlock:
+		for i, x := range n.Items {
+			// the items of a block are rendered apart, the parser having
+			// dropped the spaces between them
+			if i > 0 {
+				*prev = ' '
+			}
+			l.text(x, prev, done)
+		}
+		return
+	case *ast.Anchor:
+		if !isURLText(n) {
+			l.text(n.Text, prev, done)
+			return
+		}
+	case *ast.Text:
+		if !done[n] {
+			n.Text = l.apply(n.Text, *prev)
+			done[n] = true
+		}
+	}
+	if s := n.Bare(); s != "" {
+		*prev, _ = utf8.DecodeLastRuneInString(s)
+	}
+}
+
+// apply returns s with the substitutions of l made. prev is the rune
+// before s, or 0 at the start of a paragraph.
+func (l locale) apply(s string, prev rune) string {
+	s = strings.ReplaceAll(s, "---", "—")
+	s = strings.ReplaceAll(s, "--", "–")
+	s = strings.ReplaceAll(s, "...", "…")
+	s = l.quote(s, prev)
+	s = units(s)
+	if l.french {
+		s = frenchRe.ReplaceAllStringFunc(s, func(m string) string {
+			if m[1:] == ":" {
+				return nbsp + ":"
+			}
+			return narrowNbsp + m[1:]
+		})
+		s = guillRe.ReplaceAllString(s, "$1"+narrowNbsp)
+	}
+	return s
+}
+
+// units puts non-breaking spaces between numbers and the units after them.
+func units(s string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range unitRe.FindAllStringSubmatchIndex(s, -1) {
+		// the unit must not be the start of a word
+		if next, _ := utf8.DecodeRuneInString(s[m[1]:]); unicode.IsLetter(next) || unicode.IsDigit(next) {
+			continue
+		}
+		out.WriteString(s[last:m[3]])
+		out.WriteString(nbsp)
+		last = m[4]
+	}
+	out.WriteString(s[last:])
+	return out.String()
+}
+
+// quote replaces the straight quotes in s.
+func (l locale) quote(s string, prev rune) string {
+	if !strings.ContainsAny(s, `"'`) {
+		return s
+	}
+	var (
+		out  strings.Builder
+		rs   = []rune(s)
+		open bool // within single quotes
+	)
+	for i, c := range rs {
+		var next rune
+		if i+1 < len(rs) {
+			next = rs[i+1]
+		}
+		q := string(c)
+		switch {
+		case c == '"' && opens(prev) && !(i == 0 && closes(next)):
+			q = l.quotes[0]
+		case c == '"':
+			q = l.quotes[1]
+		case c == '\'' && isWord(prev) && (isWord(next) || !open):
+			q = "’" // an apostrophe
+		case c == '\'' && opens(prev):
+			q = l.quotes[2]
+			open = true
+		case c == '\'':
+			q = l.quotes[3]
+			open = false
+		}
+		out.WriteString(q)
+		prev, _ = utf8.DecodeLastRuneInString(q)
+	}
+	return out.String()
+}
+
+// isURLText reports whether the text of a is its URL, as with autolinks,
+// which must be left as they are.
+func isURLText(a *ast.Anchor) bool {
+	s := a.Text.Bare()
+	return s == a.URL || "https://"+s == a.URL || "mailto:"+s == a.URL
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// closes reports whether a quote before r, at the start of an item, is a
+// closing one, as in `"a *b*" c`.
+func closes(r rune) bool {
+	return r == 0 || unicode.IsSpace(r) || strings.ContainsRune(".,;:!?)]}", r)
+}
+
+// opens reports whether a quote after r is an opening one.
+func opens(r rune) bool {
+	return r == 0 || unicode.IsSpace(r) || strings.ContainsRune("([{<—–-/“‘„‚«‹「『", r)
+}
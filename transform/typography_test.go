@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"github.com/insomnimus/typeup/ast"
+	"strings"
+	"testing"
+)
+
+// bare returns the text of the paragraphs of d.
+func bare(d *Document) string {
+	var paras []string
+	for _, n := range d.Nodes {
+		if tb, ok := n.(*ast.TextBlock); ok {
+			paras = append(paras, tb.Bare())
+		}
+	}
+	return strings.Join(paras, "\n")
+}
+
+func TestTypography(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`He said "loudly"`, "He said “loudly”"},
+		{`He said *very* "loudly"`, "He said very “loudly”"},
+		{"a `code` \"q\"", "a code “q”"},
+		{`see [link http://x] "quoted"`, "see link “quoted”"},
+		{`"quoted *word*" end`, "“quoted word ” end"},
+		{`it's 'single'`, "it’s ‘single’"},
+		{"wait... -- and --- done", "wait… – and — done"},
+		{"5 min, 10 ms, 3 mg, 9 mV", "5\u00a0min, 10\u00a0ms, 3\u00a0mg, 9\u00a0mV"},
+		{"2 m, 4 km, 5 kg, 1 mA, 6 ml", "2\u00a0m, 4\u00a0km, 5\u00a0kg, 1\u00a0mA, 6\u00a0ml"},
+		{"3 men, 4 hours", "3 men, 4 hours"},
+	}
+	for _, test := range tests {
+		d := parse(t, test.src+"\n")
+		if err := Typography("en")(d); err != nil {
+			t.Fatal(err)
+		}
+		if got := bare(d); got != test.want {
+			t.Errorf("%s\ngot  %q\nwant %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestTypographyAutolinks(t *testing.T) {
+	d := parse(t, "see https://example.com/a--b...c and \"this\"\n")
+	if err := (Pipeline{Autolink(), Typography("en")}).Run(d); err != nil {
+		t.Fatal(err)
+	}
+	want := "see  https://example.com/a--b...c  and “this”"
+	if got := bare(d); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
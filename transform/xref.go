@@ -0,0 +1,105 @@
+package transform
+
+import (
+	"encoding/json"
+	"github.com/insomnimus/typeup/ast"
+	"strconv"
+)
+
+func init() {
+	Register("cross-references", func(json.RawMessage) (Pass, error) {
+		return CrossReferences(), nil
+	})
+}
+
+// target is what a cross reference links to.
+type target struct {
+	url, text string
+	heading   *ast.Heading // nil if it is not a heading
+}
+
+// headingText returns the text of a link to h.
+func headingText(h *ast.Heading) string {
+	if h.Number != "" {
+		return "Section " + h.Number
+	}
+	return h.Title.Bare()
+}
+
+// CrossReferences returns a pass numbering the labelled tables, images
+// and code blocks and replacing the cross references to them and to
+// headings with links, whose text is like "Table 2" or "Section 1.3".
+// A heading without a number is referred to by its title; if the headings
+// are numbered by a later pass, the links are updated. References to
+// undefined labels are left as they are written, with a warning.
+func CrossReferences() Pass {
+	return func(d *Document) error {
+		var (
+			targets = make(map[string]target)
+			counts  = make(map[string]int)
+		)
+		add := func(n ast.Node, label string, t target) {
+			if _, dup := targets[label]; dup {
+				d.WarnAt(n, "label %q defined more than once, using the first definition", label)
+				return
+			}
+			targets[label] = t
+		}
+		number := func(n ast.Node, kind, label string) string {
+			counts[kind]++
+			num := strconv.Itoa(counts[kind])
+			add(n, label, target{url: "#" + label, text: kind + " " + num})
+			return num
+		}
+		d.Walk(func(n interface{}) bool {
+			switch n := n.(type) {
+			case *ast.Heading:
+				if n.Label == "" {
+					return false
+				}
+				add(n, n.Label, target{url: "#" + n.ID, text: headingText(n), heading: n})
+				return false
+			case *ast.Table:
+				if n.Label != "" {
+					n.Number = number(n, "Table", n.Label)
+				}
+			case *ast.Image:
+				if n.Label != "" {
+					n.Number = number(n, "Figure", n.Label)
+				}
+			case *ast.Code:
+				if n.Label != "" {
+					n.Number = number(n, "Listing", n.Label)
+				}
+			}
+			return true
+		})
+		d.Walk(func(n interface{}) bool {
+			tb, ok := n.(*ast.TextBlock)
+			if !ok {
+				return true
+			}
+			for i, x := range tb.Items {
+				ref, ok := x.(*ast.Ref)
+				if !ok {
+					continue
+				}
+				if t, ok := targets[ref.Label]; ok {
+					a := &ast.Anchor{Text: &ast.Text{Text: t.text}, URL: t.url}
+					if t.heading != nil {
+						if d.headingRefs == nil {
+							d.headingRefs = make(map[*ast.Anchor]*ast.Heading)
+						}
+						d.headingRefs[a] = t.heading
+					}
+					tb.Items[i] = a
+				} else {
+					d.WarnAt(ref, "reference to undefined label %q", ref.Label)
+					tb.Items[i] = &ast.Text{Text: "[@" + ref.Label + "]"}
+				}
+			}
+			return true
+		})
+		return nil
+	}
+}
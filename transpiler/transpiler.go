@@ -2,46 +2,129 @@ package transpiler
 
 import (
 	"fmt"
+	"github.com/insomnimus/typeup/ast"
 	"github.com/insomnimus/typeup/parser"
+	"github.com/insomnimus/typeup/render"
+	"github.com/insomnimus/typeup/transform"
 	"html"
 	"io"
+	"strings"
 )
 
-func ToHTML(stdin io.Reader, stdout, stderr io.Writer) error {
-	data, err := io.ReadAll(stdin)
-	if err != nil {
-		return err
+type Document struct {
+	Nodes    []ast.Node
+	Meta     map[string]string
+	Warnings []*parser.Warning
+	// where the nodes start in the source, for the warnings of passes
+	positions map[ast.Node]transform.Position
+}
+
+func Parse(src string) *Document {
+	return ParseWith(parser.New(src))
+}
+
+// ParseWith parses the document of p, which may have extensions
+// registered.
+func ParseWith(p *parser.Parser) *Document {
+	var (
+		nodes     []ast.Node
+		positions = make(map[ast.Node]transform.Position)
+	)
+	for start := p.Pos(); ; start = p.Pos() {
+		n := p.Next()
+		if n == nil {
+			break
+		}
+		nodes = append(nodes, n)
+		line, column := p.LineColumn(start)
+		positions[n] = transform.Position{Line: line, Column: column}
 	}
+	return &Document{
+		Nodes:     nodes,
+		Meta:      p.Metas(),
+		Warnings:  p.Warnings(),
+		positions: positions,
+	}
+}
+
+// Apply runs transform.Defaults and then the passes of pl on d, and
+// returns the warnings they report.
+func (d *Document) Apply(pl transform.Pipeline) ([]string, error) {
+	td := &transform.Document{Nodes: d.Nodes, Meta: d.Meta, Positions: d.positions}
+	err := append(transform.Defaults[:len(transform.Defaults):len(transform.Defaults)], pl...).Run(td)
+	d.Nodes, d.Meta = td.Nodes, td.Meta
+	return td.Warnings, err
+}
+
+// HTML is the renderer used by WriteHTML.
+var HTML = &render.HTML{}
 
-	var content []string
-	p := parser.New(string(data))
-	for n := p.Next(); n != nil; n = p.Next() {
-		content = append(content, n.HTML())
+// katexHead loads KaTeX and renders the math output in render.KaTeX mode.
+const katexHead = `<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/katex@0.16.9/dist/katex.min.css">
+<script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.9/dist/katex.min.js"></script>
+<script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.9/dist/contrib/auto-render.min.js" onload="renderMathInElement(document.body)"></script>`
+
+func (d *Document) WriteHTML(w io.Writer) error {
+	var head []string
+	if title, ok := d.Meta["title"]; ok {
+		head = append(head, fmt.Sprintf("<title>\n %s \n</title>", html.EscapeString(title)))
+	}
+	if HTML.MathMode == render.KaTeX && d.hasMath() {
+		head = append(head, katexHead)
+	}
+	doc := "<html>"
+	if len(head) > 0 {
+		doc += "\n<head> " + strings.Join(head, "\n") + " </head>"
 	}
-	/*########
-	if meta := p.Metas(); len(meta) > 0 {
-		for key, val := range meta {
-			fmt.Fprintln(stderr, key, "=", val)
+	doc += "\n<body>"
+	if _, err := fmt.Fprintln(w, doc); err != nil {
+		return err
+	}
+	for _, x := range d.Nodes {
+		s := HTML.Node(x)
+		if s == "" {
+			// ignore blocks and link definitions
+			continue
+		}
+		if _, err := fmt.Fprintln(w, s); err != nil {
+			return err
 		}
 	}
-	########*/
+	_, err := fmt.Fprint(w, "</body>\n</html>")
+	return err
+}
 
-	if warns := p.Warnings(); len(warns) > 0 {
-		for _, w := range warns {
-			fmt.Fprintln(stderr, w)
-		}
+func (d *Document) hasMath() bool {
+	found := false
+	for _, n := range d.Nodes {
+		ast.Inspect(n, func(n interface{}) bool {
+			_, ok := n.(*ast.Math)
+			found = found || ok
+			return !found
+		})
 	}
+	return found
+}
 
-	doc := "<html>"
-	if title, ok := p.Meta("title"); ok {
-		doc += fmt.Sprintf("\n<head> <title>\n %s \n</title> </head>", html.EscapeString(title))
+// ToHTML converts the document read from stdin to HTML, running the
+// default passes, and writes the warnings to stderr.
+func ToHTML(stdin io.Reader, stdout, stderr io.Writer) error {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
 	}
-	doc += "\n<body>"
-	fmt.Fprintln(stdout, doc)
-	for _, x := range content {
-		fmt.Fprintln(stdout, x)
+
+	d := Parse(string(data))
+	for _, w := range d.Warnings {
+		fmt.Fprintln(stderr, w)
+	}
+	warnings, err := d.Apply(nil)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Fprintln(stderr, w)
 	}
-	fmt.Fprint(stdout, "</body>\n</html>")
 
-	return nil
+	return d.WriteHTML(stdout)
 }
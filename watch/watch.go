@@ -0,0 +1,109 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Watcher detects changes to a set of files by polling their modification
+// times and sizes. It needs no platform specific notification API.
+type Watcher struct {
+	Interval time.Duration
+	// List returns the files to watch. It is called on every poll so that
+	// new files are picked up.
+	List func() ([]string, error)
+
+	stamps map[string]stamp
+}
+
+type stamp struct {
+	mod  time.Time
+	size int64
+}
+
+// Files returns a List function for a fixed set of files.
+func Files(paths ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		return paths, nil
+	}
+}
+
+// Dir returns a List function that lists every regular file under root,
+// skipping the directories in skip.
+func Dir(root string, skip ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		var files []string
+		err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				for _, s := range skip {
+					if filepath.Clean(p) == filepath.Clean(s) {
+						return filepath.SkipDir
+					}
+				}
+				return nil
+			}
+			files = append(files, p)
+			return nil
+		})
+		return files, err
+	}
+}
+
+// Poll checks the files once and returns the ones that were created,
+// modified or removed since the previous call.
+// The first call only records the current state and returns nothing.
+func (w *Watcher) Poll() ([]string, error) {
+	files, err := w.List()
+	if err != nil {
+		return nil, err
+	}
+	first := w.stamps == nil
+	stamps := make(map[string]stamp, len(files))
+	var changed []string
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		st := stamp{mod: info.ModTime(), size: info.Size()}
+		stamps[f] = st
+		if old, ok := w.stamps[f]; !first && (!ok || old != st) {
+			changed = append(changed, f)
+		}
+	}
+	for f := range w.stamps {
+		if _, ok := stamps[f]; !ok {
+			changed = append(changed, f)
+		}
+	}
+	w.stamps = stamps
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// Run polls forever, calling fn with the changed files after every poll that
+// found changes. It returns only if listing the files fails.
+func (w *Watcher) Run(fn func(changed []string)) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	if _, err := w.Poll(); err != nil {
+		return err
+	}
+	for {
+		time.Sleep(interval)
+		changed, err := w.Poll()
+		if err != nil {
+			return err
+		}
+		if len(changed) > 0 {
+			fn(changed)
+		}
+	}
+}